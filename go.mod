@@ -1,5 +1,5 @@
 module github.com/laonix/sample-handler
 
-go 1.18
+go 1.20
 
 require github.com/golang/mock v1.6.0
@@ -0,0 +1,41 @@
+package http
+
+import "sync/atomic"
+
+// adaptiveConcurrency scales a number of URLs each request fetches at the same time
+// inversely to a number of requests in flight.
+type adaptiveConcurrency struct {
+	min, max int
+
+	// inFlight is a number of requests being served, accessed atomically.
+	inFlight int64
+}
+
+// begin counts a request in flight, the returned function must be called once the request is served.
+func (ac *adaptiveConcurrency) begin() (end func()) {
+	atomic.AddInt64(&ac.inFlight, 1)
+
+	return func() {
+		atomic.AddInt64(&ac.inFlight, -1)
+	}
+}
+
+// limit returns a number of URLs a request is allowed to fetch at the same time:
+// max when the request is the only one in flight, then max divided by a number of requests in flight,
+// but never less than min nor than one.
+func (ac *adaptiveConcurrency) limit() int {
+	inFlight := int(atomic.LoadInt64(&ac.inFlight))
+	if inFlight < 1 {
+		inFlight = 1
+	}
+
+	limit := ac.max / inFlight
+	if limit < ac.min {
+		limit = ac.min
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	return limit
+}
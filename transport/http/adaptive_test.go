@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestAdaptiveConcurrency_limit(t *testing.T) {
+	ac := &adaptiveConcurrency{min: 2, max: 16}
+
+	tests := []struct {
+		inFlight int64
+		want     int
+	}{
+		{inFlight: 0, want: 16},
+		{inFlight: 1, want: 16},
+		{inFlight: 4, want: 4},
+		{inFlight: 100, want: 2},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt64(&ac.inFlight, tt.inFlight)
+
+		if got := ac.limit(); got != tt.want {
+			t.Errorf("wrong limit of %d requests in flight: want = %d, got = %d", tt.inFlight, tt.want, got)
+		}
+	}
+}
+
+func TestWithAdaptiveConcurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var active, maxActive int32
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		return response(http.StatusOK), nil
+	}).Times(20)
+
+	handler := newResponseSizeCounter(t, WithAdaptiveConcurrency(1, 8))
+	handler.SetClient(client)
+
+	// 7 more requests in flight leave a single fetch at a time to the one served
+	for i := 0; i < 7; i++ {
+		defer handler.adaptive.begin()()
+	}
+
+	for _, accept := range []string{"application/x-ndjson", "application/json"} {
+		req := streamRequest(10)
+		req.Header.Set("Accept", accept)
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: wrong response status: want = %d, got = %d", accept, http.StatusOK, w.Code)
+		}
+
+		if maxActive != 1 {
+			t.Errorf("%s: concurrency is not reduced under load: want = %d, got = %d", accept, 1, maxActive)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	net_url "net/url"
+	"strings"
+)
+
+// errHostNotAllowed fails fetches of URLs, sitemaps and redirects of a host out of the allowlist.
+var errHostNotAllowed = errors.New("host is not allowed")
+
+// hostAllowlist is a list of host patterns URLs are allowed to be fetched from,
+// a pattern is either a host name or a wildcard like *.example.com matching any of its subdomains.
+type hostAllowlist []string
+
+// allows reports whether a host of a given URL matches any pattern of the list.
+// Every URL is allowed by an empty list, so are URLs having no host, e.g. of local files.
+func (l hostAllowlist) allows(url string) bool {
+	if len(l) == 0 {
+		return true
+	}
+
+	u, err := net_url.Parse(url)
+	if err != nil {
+		return false
+	}
+	if u.Host == "" {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range l {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// disallowed returns an error naming the first of given targets whose host is not allowed, if any.
+func (l hostAllowlist) disallowed(targets []target) error {
+	for _, t := range targets {
+		if !l.allows(t.URL) {
+			return fmt.Errorf("'%s': %w", t.URL, errHostNotAllowed)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package http
+
+import "testing"
+
+func Test_hostAllowlist_allows(t *testing.T) {
+	list := hostAllowlist{"example.com", "*.example.org"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://example.com", want: true},
+		{url: "https://example.com:8080/path", want: true},
+		{url: "https://www.example.com", want: false},
+		{url: "https://cdn.example.org", want: true},
+		{url: "https://a.b.example.org", want: true},
+		{url: "https://example.org", want: false},
+		{url: "https://badexample.org", want: false},
+		{url: "https://example.com.evil.com", want: false},
+		{url: "file:///var/www/index.html", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := list.allows(tt.url); got != tt.want {
+			t.Errorf("wrong result for %s: want = %t, got = %t", tt.url, tt.want, got)
+		}
+	}
+
+	if !(hostAllowlist{}).allows("https://any.com") {
+		t.Error("empty list does not allow any host")
+	}
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxDecompressedSize limits a size of a decompressed request body, unless a maximum request size is configured,
+// so a small compressed body never expands to an unbounded one.
+const defaultMaxDecompressedSize = 64 << 20
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errMalformedEncoding   = errors.New("malformed content encoding")
+)
+
+// requestBody returns a body of a given request, decompressed if it has gzip content encoding.
+// A body larger than the maximum request size, if any, fails to be read with *http.MaxBytesError;
+// the limit applies to a decompressed body, which is limited by default anyway.
+func (h *ResponseSizeCounter) requestBody(req *http.Request) (io.Reader, error) {
+	limit := h.maxRequestSize
+
+	var body io.ReadCloser = req.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errMalformedEncoding, err)
+		}
+		body = gz
+
+		if limit <= 0 {
+			limit = defaultMaxDecompressedSize
+		}
+	default:
+		return nil, fmt.Errorf("'%s': %w", encoding, errUnsupportedEncoding)
+	}
+
+	if limit > 0 {
+		body = http.MaxBytesReader(nil, body, limit)
+	}
+
+	return encodingErrorReader{body}, nil
+}
+
+// encodingErrorReader is a reader of a decompressed body marking errors of decompression as malformed encoding.
+type encodingErrorReader struct {
+	r io.Reader
+}
+
+func (r encodingErrorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &corrupt) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: %s", errMalformedEncoding, err)
+	}
+
+	return n, err
+}
+
+// targetsErrorStatus returns a response status of a given error of getting targets of a request.
+func targetsErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errLineTooLong), errors.Is(err, errMalformedEncoding), errors.Is(err, errMalformedTargets):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, r io.Reader) []byte {
+	var buf bytes.Buffer
+
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		t.Fatalf("cannot create gzip writer: %s", err)
+	}
+	if _, err := io.Copy(gz, r); err != nil {
+		t.Fatalf("cannot compress: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("cannot close gzip writer: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestResponseSizeCounter_ServeHTTP_gzippedBody(t *testing.T) {
+	urls := "https://test-1.com\nhttps://test-2.com\nhttps://test-3.com"
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+	}{
+		{name: "lines", encoding: "gzip", body: gzipped(t, strings.NewReader(urls))},
+		{name: "JSON", contentType: "application/json", encoding: "gzip",
+			body: gzipped(t, strings.NewReader(`[{"url":"https://test-1.com"},{"url":"https://test-2.com"},{"url":"https://test-3.com"}]`))},
+		{name: "x-gzip", encoding: "x-gzip", body: gzipped(t, strings.NewReader(urls))},
+		{name: "identity", encoding: "identity", body: []byte(urls)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newResponseSizeCounter(t)
+			handler.SetClient(StaticGetter{Size: 10})
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &net_url.URL{RawQuery: "format=json"},
+				Header: http.Header{"Content-Encoding": {tt.encoding}},
+				Body:   io.NopCloser(bytes.NewReader(tt.body)),
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+
+			var results []Result
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("cannot decode response body: %s", err)
+			}
+
+			if len(results) != 3 || results[2].URL != "https://test-3.com" || results[2].Size != 10 {
+				t.Errorf("wrong results: %+v", results)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_rejectedBody(t *testing.T) {
+	// a few KiB of compressed zeros expand to 16 MiB, to the default limit and beyond
+	bomb := gzipped(t, io.LimitReader(zeroReader{}, 16<<20))
+	bigBomb := gzipped(t, io.LimitReader(zeroReader{}, defaultMaxDecompressedSize+1))
+
+	malformed := gzipped(t, strings.NewReader("https://test-1.com"))
+	malformed[len(malformed)-5] ^= 0xff
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{name: "bomb over configured limit", opts: []Option{WithMaxRequestSize(1 << 20)}, encoding: "gzip", body: bomb, status: http.StatusRequestEntityTooLarge},
+		{name: "bomb over default limit", encoding: "gzip", body: bigBomb, status: http.StatusRequestEntityTooLarge},
+		{name: "plain body over limit", opts: []Option{WithMaxRequestSize(10)}, body: []byte("https://test-1.com"), status: http.StatusRequestEntityTooLarge},
+		{name: "malformed", encoding: "gzip", body: malformed, status: http.StatusBadRequest},
+		{name: "not gzipped", encoding: "gzip", body: []byte("https://test-1.com"), status: http.StatusBadRequest},
+		{name: "unsupported", encoding: "br", body: []byte("https://test-1.com"), status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newResponseSizeCounter(t, tt.opts...)
+			handler.SetClient(StaticGetter{Size: 10})
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &net_url.URL{},
+				Header: http.Header{},
+				Body:   io.NopCloser(bytes.NewReader(tt.body)),
+			}
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("wrong status: want = %d, got = %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+)
+
+// caBundleHeader is a header of an incoming request naming a registered CA bundle
+// to verify certificates of its https URLs with.
+const caBundleHeader = "X-CA-Bundle"
+
+// caBundleKey is a context key of a name of a CA bundle selected by an incoming request.
+type caBundleKey struct{}
+
+// errNoCertificates is an error of a CA bundle holding no PEM certificates.
+var errNoCertificates = errors.New("CA bundle holds no PEM certificates")
+
+// caPool returns a pool of system root certificates extended with certificates of a given PEM bundle.
+func caPool(pem []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errNoCertificates
+	}
+
+	return pool, nil
+}
+
+// withRootCAs sets root certificates of a given transport.
+func withRootCAs(t *http.Transport, pool *x509.CertPool) {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.RootCAs = pool
+}
+
+// caBundleTransport performs requests of https URLs with a transport trusting a CA bundle
+// selected by a context of the request, if any, other requests are performed by the default transport.
+type caBundleTransport struct {
+	def     *http.Transport
+	bundles map[string]*http.Transport
+}
+
+// newCABundleTransport returns a caBundleTransport having a clone of a given default transport
+// for each of given named pools, so the clones share options configuring the default one.
+func newCABundleTransport(def *http.Transport, pools map[string]*x509.CertPool) *caBundleTransport {
+	t := &caBundleTransport{def: def, bundles: make(map[string]*http.Transport, len(pools))}
+	for name, pool := range pools {
+		bundle := def.Clone()
+		withRootCAs(bundle, pool)
+		t.bundles[name] = bundle
+	}
+
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *caBundleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if name, ok := req.Context().Value(caBundleKey{}).(string); ok && req.URL.Scheme == "https" {
+		if bundle, ok := t.bundles[name]; ok {
+			return bundle.RoundTrip(req)
+		}
+	}
+
+	return t.def.RoundTrip(req)
+}
+
+// withCABundle returns a copy of a given request selecting a CA bundle named by its header, if any.
+// It reports false if the header names an unknown bundle.
+func (h *ResponseSizeCounter) withCABundle(req *http.Request) (*http.Request, bool) {
+	name := req.Header.Get(caBundleHeader)
+	if name == "" {
+		return req, true
+	}
+
+	if _, ok := h.caBundles[name]; !ok {
+		return req, false
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), caBundleKey{}, name)), true
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	if _, err := newResponseSizeCounter(t).do(context.Background(), target{URL: srv.URL}); err == nil {
+		t.Error("certificate of unknown CA is trusted")
+	}
+
+	handler := newResponseSizeCounter(t, WithCABundle(certPEM(srv)))
+
+	result, err := handler.do(context.Background(), target{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("certificate of bundled CA is not trusted: %s", err)
+	}
+
+	if result.Size != 4 {
+		t.Errorf("wrong response size: want = %d, got = %d", 4, result.Size)
+	}
+}
+
+func TestWithCABundle_noCertificates(t *testing.T) {
+	_, err := NewResponseSizeCounter(WithCABundle([]byte("not a certificate")))
+	if !errors.Is(err, errNoCertificates) {
+		t.Errorf("wrong error: want = %v, got = %v", errNoCertificates, err)
+	}
+}
+
+func TestWithNamedCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithNamedCABundle("internal", certPEM(srv)))
+
+	tests := []struct {
+		name   string
+		bundle string
+		status int
+		failed bool
+	}{
+		{name: "no bundle", bundle: "", status: http.StatusBadGateway, failed: true},
+		{name: "named bundle", bundle: "internal", status: http.StatusOK, failed: false},
+		{name: "unknown bundle", bundle: "external", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{
+				Method: http.MethodPost,
+				Header: http.Header{"Accept": []string{"application/json"}},
+				Body:   io.NopCloser(strings.NewReader(srv.URL)),
+			}
+			if tt.bundle != "" {
+				req.Header.Set(caBundleHeader, tt.bundle)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("wrong response status: want = %d, got = %d: %s", tt.status, w.Code, w.Body)
+			}
+
+			if tt.status == http.StatusBadRequest {
+				return
+			}
+
+			var results []Result
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("cannot decode response body: %s", err)
+			}
+
+			if len(results) != 1 || (results[0].Error != "") != tt.failed {
+				t.Errorf("wrong results: %+v", results)
+			}
+		})
+	}
+}
+
+// certPEM returns a PEM-encoded certificate of a given TLS test server, which is self-signed.
+func certPEM(srv *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	net_url "net/url"
+	"sync"
+	"time"
+)
+
+// skippedByCircuit is a reason of skipping URLs of hosts having an open circuit.
+const skippedByCircuit = "circuit open"
+
+// circuitBreaker stops fetching URLs of hosts failing consecutively.
+//
+// After a threshold of consecutive failures a circuit of a host opens and its URLs are not fetched for a cooldown.
+// Then a single probe fetch is allowed: the circuit is closed if it succeeds and opens once again otherwise.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// circuit holds a state of a single host.
+type circuit struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		hosts:     make(map[string]*circuit),
+	}
+}
+
+// allow reports whether a URL of a given host is allowed to be fetched.
+func (cb *circuitBreaker) allow(host string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[host]
+	if !ok || c.failures < cb.threshold {
+		return true
+	}
+
+	if c.probing || cb.now().Sub(c.openedAt) < cb.cooldown {
+		return false
+	}
+
+	c.probing = true
+
+	return true
+}
+
+// record registers an outcome of fetching a URL of a given host.
+func (cb *circuitBreaker) record(host string, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err == nil {
+		delete(cb.hosts, host)
+		return
+	}
+
+	c, ok := cb.hosts[host]
+	if !ok {
+		c = &circuit{}
+		cb.hosts[host] = c
+	}
+
+	c.failures++
+	c.probing = false
+
+	if c.failures >= cb.threshold {
+		c.openedAt = cb.now()
+	}
+}
+
+// release ends a probe of a given host, if any, without registering an outcome,
+// so a cancelled probe doesn't keep a circuit open.
+func (cb *circuitBreaker) release(host string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.hosts[host]; ok {
+		c.probing = false
+	}
+}
+
+// urlHost returns a host of a given URL, an empty string if it fails to be parsed.
+func urlHost(url string) string {
+	u, err := net_url.Parse(url)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const (
+		failing = "https://test-1.com/path"
+		healthy = "https://test-2.com"
+	)
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		gomock.InOrder(
+			client.EXPECT().Do(requestTo(failing)).Return(nil, errors.New("connection refused")).Times(2),
+			// a probe after the first cooldown
+			client.EXPECT().Do(requestTo(failing)).Return(nil, errors.New("connection refused")),
+			// a probe after the second cooldown
+			client.EXPECT().Do(requestTo(failing)).Return(response(http.StatusOK), nil),
+			client.EXPECT().Do(requestTo(failing)).Return(response(http.StatusOK), nil),
+		)
+		client.EXPECT().Do(requestTo(healthy)).DoAndReturn(func(*http.Request) (*http.Response, error) {
+			return response(http.StatusOK), nil
+		}).Times(2)
+	}
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	handler := newResponseSizeCounter(t, WithCircuitBreaker(2, time.Minute))
+	handler.client = client
+	handler.breaker.now = clock.Now
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		url     string
+		skipped bool
+	}{
+		{name: "first failure", url: failing},
+		{name: "second failure opens circuit", url: failing},
+		{name: "open circuit", advance: 30 * time.Second, url: failing, skipped: true},
+		{name: "other host", url: healthy},
+		{name: "failed probe reopens circuit", advance: 30 * time.Second, url: failing},
+		{name: "reopened circuit", advance: 59 * time.Second, url: failing, skipped: true},
+		{name: "successful probe closes circuit", advance: time.Second, url: failing},
+		{name: "closed circuit", url: failing},
+		{name: "other host once again", url: healthy},
+	}
+
+	for _, step := range steps {
+		clock.Advance(step.advance)
+
+		result, _ := handler.fetch(context.Background(), target{URL: step.url}, params{})
+
+		if skipped := result.Skipped == skippedByCircuit; skipped != step.skipped {
+			t.Errorf("%s: wrong short-circuiting: want = %t, got = %t", step.name, step.skipped, skipped)
+		}
+	}
+}
+
+func TestCircuitBreaker_singleProbe(t *testing.T) {
+	cb := newCircuitBreaker(1, time.Minute)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cb.now = clock.Now
+
+	cb.record("test-1.com", errors.New("timeout"))
+
+	clock.Advance(time.Minute)
+
+	if !cb.allow("test-1.com") {
+		t.Error("probe is not allowed after cooldown")
+	}
+
+	if cb.allow("test-1.com") {
+		t.Error("second probe is allowed while the first one is in progress")
+	}
+}
+
+func TestWithCircuitBreaker_cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const url = "https://test-1.com"
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		gomock.InOrder(
+			client.EXPECT().Do(requestTo(url)).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				cancel()
+				return nil, req.Context().Err()
+			}),
+			client.EXPECT().Do(requestTo(url)).Return(response(http.StatusOK), nil),
+		)
+	}
+
+	handler := newResponseSizeCounter(t, WithCircuitBreaker(1, time.Minute))
+	handler.client = client
+
+	if _, err := handler.fetch(ctx, target{URL: url}, params{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error of cancelled fetch: want = %v, got = %v", context.Canceled, err)
+	}
+
+	result, err := handler.fetch(context.Background(), target{URL: url}, params{})
+	if err != nil || result.Skipped != "" {
+		t.Errorf("cancelled fetch opened circuit: skipped = %q, err = %v", result.Skipped, err)
+	}
+}
+
+func TestCircuitBreaker_releasedProbe(t *testing.T) {
+	cb := newCircuitBreaker(1, time.Minute)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cb.now = clock.Now
+
+	cb.record("test-1.com", errors.New("timeout"))
+
+	clock.Advance(time.Minute)
+
+	if !cb.allow("test-1.com") {
+		t.Fatal("probe is not allowed after cooldown")
+	}
+
+	cb.release("test-1.com")
+
+	if !cb.allow("test-1.com") {
+		t.Error("probe is not allowed after the previous one is released")
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errInvalidOption is an error of options a handler is unable to be configured with.
+var errInvalidOption = errors.New("invalid option")
+
+// validate returns an error joining every problem of options the handler is configured with, if any:
+// negative limits and durations, unknown modes and options contradicting each other.
+func (h *ResponseSizeCounter) validate() error {
+	errs := append([]error(nil), h.optionErrs...)
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: %s", errInvalidOption, fmt.Sprintf(format, args...)))
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{"max redirects", int64(h.maxRedirects)},
+		{"stream buffer", int64(h.streamBuffer)},
+		{"warm-ups", int64(h.warmUps)},
+		{"retries", int64(h.retries)},
+		{"max body size", h.maxBodySize},
+		{"max content length", h.maxContentLength},
+		{"size gate", h.sizeGate},
+		{"max request size", h.maxRequestSize},
+		{"max source size", h.maxSourceSize},
+		{"max line length", int64(h.maxLineLength)},
+		{"max header bytes", h.transport.MaxResponseHeaderBytes},
+	} {
+		if limit.value < 0 {
+			invalid("%s %d is negative", limit.name, limit.value)
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"fetch timeout", h.fetchTimeout},
+		{"max fetch timeout", h.maxFetchTimeout},
+		{"retry delay", h.retryDelay},
+		{"retry budget", h.retryBudget},
+		{"stream idle timeout", h.streamIdleTimeout},
+		{"dial timeout", h.dialer.Timeout},
+		{"TLS handshake timeout", h.transport.TLSHandshakeTimeout},
+	} {
+		if d.value < 0 {
+			invalid("%s %s is negative", d.name, d.value)
+		}
+	}
+
+	if h.fetchTimeout > 0 && h.maxFetchTimeout > 0 && h.fetchTimeout > h.maxFetchTimeout {
+		invalid("fetch timeout %s exceeds max fetch timeout %s", h.fetchTimeout, h.maxFetchTimeout)
+	}
+	if h.retryBudget > 0 && h.retries == 0 {
+		invalid("retry budget is set without retries")
+	}
+	if h.sizeGate > 0 && h.maxContentLength > 0 && h.sizeGate >= h.maxContentLength {
+		invalid("size gate %d is not below max content length %d, so no URL is skipped", h.sizeGate, h.maxContentLength)
+	}
+
+	if h.adaptive != nil && (h.adaptive.min < 1 || h.adaptive.max < h.adaptive.min) {
+		invalid("adaptive concurrency bounds %d..%d are out of order or not positive", h.adaptive.min, h.adaptive.max)
+	}
+	if h.breaker != nil && (h.breaker.threshold < 1 || h.breaker.cooldown < 0) {
+		invalid("circuit breaker threshold %d or cooldown %s is out of range", h.breaker.threshold, h.breaker.cooldown)
+	}
+
+	if h.allFailedStatus < 100 || h.allFailedStatus > 599 {
+		invalid("all failed status %d is not an HTTP status", h.allFailedStatus)
+	}
+	if h.mismatchStatus != 0 && (h.mismatchStatus < 100 || h.mismatchStatus > 599) {
+		invalid("mismatch status %d is not an HTTP status", h.mismatchStatus)
+	}
+
+	if h.redirectSizeMode < RedirectSizeFinal || h.redirectSizeMode > RedirectSizeSum {
+		invalid("unknown redirect size mode %d", h.redirectSizeMode)
+	}
+	if h.schemeDowngradeMode < SchemeDowngradeFollow || h.schemeDowngradeMode > SchemeDowngradeBlock {
+		invalid("unknown scheme downgrade mode %d", h.schemeDowngradeMode)
+	}
+	if h.retrySizePolicy < RetrySizeLast || h.retrySizePolicy > RetrySizeMin {
+		invalid("unknown retry size policy %d", h.retrySizePolicy)
+	}
+	if h.sort < SortNone || h.sort > SortByURL {
+		invalid("unknown sort order %d", h.sort)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewResponseSizeCounter_invalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "negative max redirects",
+			opts: []Option{WithMaxRedirects(-1)},
+			want: "max redirects -1 is negative",
+		},
+		{
+			name: "negative retry delay",
+			opts: []Option{WithRetries(2, -time.Second)},
+			want: "retry delay -1s is negative",
+		},
+		{
+			name: "negative max line length",
+			opts: []Option{WithMaxLineLength(-1)},
+			want: "max line length -1 is negative",
+		},
+		{
+			name: "negative max header bytes",
+			opts: []Option{WithMaxHeaderBytes(-1)},
+			want: "max header bytes -1 is negative",
+		},
+		{
+			name: "negative dial timeout",
+			opts: []Option{WithDialTimeout(-time.Second)},
+			want: "dial timeout -1s is negative",
+		},
+		{
+			name: "negative TLS handshake timeout",
+			opts: []Option{WithTLSHandshakeTimeout(-time.Second)},
+			want: "TLS handshake timeout -1s is negative",
+		},
+		{
+			name: "unix sockets without allowed ones",
+			opts: []Option{WithUnixSockets(nil)},
+			want: "no unix sockets are allowed",
+		},
+		{
+			name: "zero max concurrent fetches",
+			opts: []Option{WithMaxConcurrentFetches(0)},
+			want: "max concurrent fetches 0 is not positive",
+		},
+		{
+			name: "fetch timeout exceeding max",
+			opts: []Option{WithFetchTimeout(2*time.Second, time.Second)},
+			want: "fetch timeout 2s exceeds max fetch timeout 1s",
+		},
+		{
+			name: "retry budget without retries",
+			opts: []Option{WithRetryBudget(time.Second)},
+			want: "retry budget is set without retries",
+		},
+		{
+			name: "size gate above max content length",
+			opts: []Option{WithSizeGate(100), WithMaxContentLength(10)},
+			want: "size gate 100 is not below max content length 10",
+		},
+		{
+			name: "adaptive concurrency out of order",
+			opts: []Option{WithAdaptiveConcurrency(4, 2)},
+			want: "adaptive concurrency bounds 4..2",
+		},
+		{
+			name: "all failed status out of range",
+			opts: []Option{WithAllFailedStatus(1000)},
+			want: "all failed status 1000 is not an HTTP status",
+		},
+		{
+			name: "unknown scheme downgrade mode",
+			opts: []Option{WithSchemeDowngradeMode(SchemeDowngradeMode(7))},
+			want: "unknown scheme downgrade mode 7",
+		},
+		{
+			name: "CA bundle without certificates",
+			opts: []Option{WithNamedCABundle("internal", []byte("not a certificate"))},
+			want: `CA bundle "internal": CA bundle holds no PEM certificates`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewResponseSizeCounter(tt.opts...)
+			if h != nil {
+				t.Error("handler is returned along with an error")
+			}
+			if !errors.Is(err, errInvalidOption) {
+				t.Fatalf("wrong error: want = %v, got = %v", errInvalidOption, err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("wrong error: want containing = %q, got = %q", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNewResponseSizeCounter_invalidOptionsJoined(t *testing.T) {
+	_, err := NewResponseSizeCounter(WithMaxRedirects(-1), WithStreamBuffer(-2))
+	if err == nil {
+		t.Fatal("invalid options are accepted")
+	}
+
+	for _, want := range []string{"max redirects -1 is negative", "stream buffer -2 is negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("wrong error: want containing = %q, got = %q", want, err)
+		}
+	}
+}
+
+func TestMakeResponseSizeCounter_invalidOptions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid options are accepted")
+		}
+	}()
+
+	MakeResponseSizeCounter(WithMaxRedirects(-1))
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// cookieJarKey is a context key of a cookie jar shared by outbound requests of an incoming one.
+type cookieJarKey struct{}
+
+// withCookieJar returns a copy of a given request carrying a new cookie jar,
+// so cookies set by responses to its outbound requests are sent with the following ones.
+func withCookieJar(req *http.Request) *http.Request {
+	// creating a jar without options never fails
+	jar, _ := cookiejar.New(nil)
+
+	return req.WithContext(context.WithValue(req.Context(), cookieJarKey{}, jar))
+}
+
+// addCookies adds cookies of a jar of the context, if any, matching a URL of a given outbound request to it.
+func addCookies(ctx context.Context, req *http.Request) {
+	jar, ok := ctx.Value(cookieJarKey{}).(http.CookieJar)
+	if !ok {
+		return
+	}
+
+	for _, cookie := range jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+}
+
+// storeCookies stores cookies set by a given response to a jar of the context, if any.
+// They are stored for a URL of the final request of the response, or of a given one if it is unknown.
+func storeCookies(ctx context.Context, req *http.Request, res *http.Response) {
+	jar, ok := ctx.Value(cookieJarKey{}).(http.CookieJar)
+	if !ok {
+		return
+	}
+
+	u := req.URL
+	if res.Request != nil && res.Request.URL != nil {
+		u = res.Request.URL
+	}
+
+	if cookies := res.Cookies(); len(cookies) > 0 {
+		jar.SetCookies(u, cookies)
+	}
+}
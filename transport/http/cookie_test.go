@@ -0,0 +1,92 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithCookieJar(t *testing.T) {
+	const (
+		authorized   = "welcome back"
+		unauthorized = "log in"
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the login page sets a session cookie the account page requires
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		res := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: req}
+
+		switch req.URL.Path {
+		case "/login":
+			res.Header.Add("Set-Cookie", "session=abc; Path=/")
+			res.Body = io.NopCloser(strings.NewReader("ok"))
+		default:
+			if cookie, err := req.Cookie("session"); err == nil && cookie.Value == "abc" {
+				res.Body = io.NopCloser(strings.NewReader(authorized))
+			} else {
+				res.StatusCode = http.StatusUnauthorized
+				res.Body = io.NopCloser(strings.NewReader(unauthorized))
+			}
+		}
+
+		return res, nil
+	}).AnyTimes()
+
+	serve := func(handler *ResponseSizeCounter, body string) []Result {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{RawQuery: "format=json"},
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		var results []Result
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatalf("cannot decode response body: %s", err)
+		}
+
+		return results
+	}
+
+	flow := "https://test.com/login\nhttps://test.com/account"
+
+	tests := []struct {
+		name string
+		opts []Option
+		body string
+		want int
+	}{
+		{name: "disabled", opts: []Option{WithMaxConcurrentFetches(1)}, body: flow, want: len(unauthorized)},
+		{name: "enabled", opts: []Option{WithCookieJar(true), WithMaxConcurrentFetches(1)}, body: flow, want: len(authorized)},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+		handler.SetClient(client)
+
+		results := serve(handler, tt.body)
+		if len(results) != 2 || results[1].Size != tt.want {
+			t.Errorf("%s: wrong results: want size of account page = %d, got = %+v", tt.name, tt.want, results)
+		}
+
+		// a jar lives as long as its incoming request
+		if results := serve(handler, "https://test.com/account"); len(results) != 1 || results[0].Size != len(unauthorized) {
+			t.Errorf("%s: cookie leaked to another request: %+v", tt.name, results)
+		}
+	}
+}
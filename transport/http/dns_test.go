@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"testing"
+	"time"
+)
+
+// slowResolver returns a resolver answering A queries of any host with 127.0.0.1 after a given delay.
+func slowResolver(delay time.Duration) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveDNS(server, delay)
+			return client, nil
+		},
+	}
+}
+
+// serveDNS answers a single DNS query framed as of TCP, as a resolver frames it over a connection which is not a packet one.
+func serveDNS(conn net.Conn, delay time.Duration) {
+	defer func() { _ = conn.Close() }()
+
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return
+	}
+	query := make([]byte, size)
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+
+	time.Sleep(delay)
+
+	// the question follows a 12 bytes header: labels of a name, then 2 bytes of a type and 2 bytes of a class
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	answers := uint16(0)
+	if qtype == 1 {
+		answers = 1
+	}
+
+	res := make([]byte, 0, 64)
+	res = append(res, query[0], query[1], 0x81, 0x80, 0, 1)
+	res = binary.BigEndian.AppendUint16(res, answers)
+	res = append(res, 0, 0, 0, 0)
+	res = append(res, query[12:end]...)
+	if answers > 0 {
+		// a name pointing to the question one, type A, class IN, TTL of 60 seconds and an IPv4 address
+		res = append(res, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+	}
+
+	_ = binary.Write(conn, binary.BigEndian, uint16(len(res)))
+	_, _ = conn.Write(res)
+}
+
+func TestWithDNSTiming(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	u, _ := net_url.Parse(srv.URL)
+	slowURL := "http://slow-dns.test:" + u.Port()
+
+	tests := []struct {
+		name string
+		opts []Option
+		urls []string
+		want []bool
+	}{
+		{name: "disabled", urls: []string{slowURL}, want: []bool{false}},
+		{name: "resolved then reused", opts: []Option{WithDNSTiming()}, urls: []string{slowURL, slowURL}, want: []bool{true, false}},
+		{name: "IP address", opts: []Option{WithDNSTiming()}, urls: []string{srv.URL}, want: []bool{false}},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+		handler.transport.DialContext = (&net.Dialer{Resolver: slowResolver(delay)}).DialContext
+
+		for i, u := range tt.urls {
+			result, err := handler.do(context.Background(), target{URL: u})
+			if err != nil {
+				t.Fatalf("%s: cannot get response: %s", tt.name, err)
+			}
+
+			if resolved := result.DNS > 0; resolved != tt.want[i] {
+				t.Errorf("%s: wrong DNS time of fetch #%d: %s", tt.name, i, result.DNS)
+			}
+
+			if tt.want[i] && (result.DNS < delay || result.DNS > result.Latency) {
+				t.Errorf("%s: DNS time of fetch #%d is not the lookup one: %s of %s", tt.name, i, result.DNS, result.Latency)
+			}
+		}
+	}
+}
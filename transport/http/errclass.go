@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Classes of failed fetches reported by results and summaries.
+const (
+	errorClassTimeout    = "timeout"
+	errorClassDNS        = "dns"
+	errorClassConnection = "connection"
+	errorClassTLS        = "tls"
+	errorClassRedirect   = "redirect"
+	errorClassHTTP4xx    = "http_4xx"
+	errorClassHTTP5xx    = "http_5xx"
+	errorClassOther      = "other"
+)
+
+// classifyError returns a class of a fetch failing with a given error or responded with a given error status,
+// empty if the fetch succeeded.
+func classifyError(status int, err error) string {
+	if err == nil {
+		switch {
+		case status >= http.StatusInternalServerError:
+			return errorClassHTTP5xx
+		case status >= http.StatusBadRequest:
+			return errorClassHTTP4xx
+		default:
+			return ""
+		}
+	}
+
+	var (
+		dnsErr         *net.DNSError
+		netErr         net.Error
+		opErr          *net.OpError
+		recordErr      tls.RecordHeaderError
+		verifyErr      *tls.CertificateVerificationError
+		authorityErr   x509.UnknownAuthorityError
+		hostnameErr    x509.HostnameError
+		certInvalidErr x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return errorClassDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errorClassTimeout
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &certInvalidErr):
+		return errorClassTLS
+	case errors.Is(err, errTooManyRedirects), errors.Is(err, errHostNotAllowed), errors.Is(err, errSchemeDowngrade),
+		errors.Is(err, errFileRedirect):
+		return errorClassRedirect
+	case errors.As(err, &opErr):
+		return errorClassConnection
+	default:
+		return errorClassOther
+	}
+}
+
+// ErrorCounts holds numbers of failed fetches by their class.
+type ErrorCounts struct {
+	Timeout    int `json:"timeout,omitempty"`
+	DNS        int `json:"dns,omitempty"`
+	Connection int `json:"connection,omitempty"`
+	TLS        int `json:"tls,omitempty"`
+	Redirect   int `json:"redirect,omitempty"`
+	HTTP4xx    int `json:"http_4xx,omitempty"`
+	HTTP5xx    int `json:"http_5xx,omitempty"`
+	Other      int `json:"other,omitempty"`
+}
+
+// add counts a failed fetch of a given class.
+func (c *ErrorCounts) add(class string) {
+	switch class {
+	case errorClassTimeout:
+		c.Timeout++
+	case errorClassDNS:
+		c.DNS++
+	case errorClassConnection:
+		c.Connection++
+	case errorClassTLS:
+		c.TLS++
+	case errorClassRedirect:
+		c.Redirect++
+	case errorClassHTTP4xx:
+		c.HTTP4xx++
+	case errorClassHTTP5xx:
+		c.HTTP5xx++
+	default:
+		c.Other++
+	}
+}
+
+// String returns non-zero counts as comma-separated class=count pairs, e.g. "timeout=3, dns=1, http_5xx=2".
+func (c ErrorCounts) String() string {
+	counts := []struct {
+		class string
+		n     int
+	}{
+		{errorClassTimeout, c.Timeout},
+		{errorClassDNS, c.DNS},
+		{errorClassConnection, c.Connection},
+		{errorClassTLS, c.TLS},
+		{errorClassRedirect, c.Redirect},
+		{errorClassHTTP4xx, c.HTTP4xx},
+		{errorClassHTTP5xx, c.HTTP5xx},
+		{errorClassOther, c.Other},
+	}
+
+	pairs := make([]string, 0, len(counts))
+	for _, count := range counts {
+		if count.n > 0 {
+			pairs = append(pairs, count.class+"="+strconv.Itoa(count.n))
+		}
+	}
+
+	return strings.Join(pairs, ", ")
+}
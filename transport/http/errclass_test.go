@@ -0,0 +1,63 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	net_url "net/url"
+	"syscall"
+	"testing"
+)
+
+func Test_classifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("GET 'https://test.com': %w", &net_url.Error{Op: "Get", URL: "https://test.com", Err: err})
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   string
+	}{
+		{name: "ok", status: http.StatusOK, want: ""},
+		{name: "redirect status", status: http.StatusFound, want: ""},
+		{name: "client error status", status: http.StatusNotFound, want: errorClassHTTP4xx},
+		{name: "server error status", status: http.StatusServiceUnavailable, want: errorClassHTTP5xx},
+		{name: "dns", err: wrap(&net.DNSError{Err: "no such host", Name: "test.com", IsNotFound: true}), want: errorClassDNS},
+		{name: "deadline", err: wrap(context.DeadlineExceeded), want: errorClassTimeout},
+		{name: "dial timeout", err: wrap(&net.OpError{Op: "dial", Err: timeoutError{}}), want: errorClassTimeout},
+		{name: "refused", err: wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), want: errorClassConnection},
+		{name: "tls", err: wrap(x509.UnknownAuthorityError{}), want: errorClassTLS},
+		{name: "redirects", err: wrap(errTooManyRedirects), want: errorClassRedirect},
+		{name: "scheme downgrade", err: wrap(errSchemeDowngrade), want: errorClassRedirect},
+		{name: "other", err: errors.New("read response body: unexpected EOF"), want: errorClassOther},
+	}
+
+	for _, tt := range tests {
+		if got := classifyError(tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: wrong class: want = %q, got = %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestErrorCounts_String(t *testing.T) {
+	var counts ErrorCounts
+	for _, class := range []string{errorClassHTTP5xx, errorClassTimeout, errorClassDNS, errorClassTimeout, errorClassHTTP5xx, errorClassTimeout} {
+		counts.add(class)
+	}
+
+	if got, want := counts.String(), "timeout=3, dns=1, http_5xx=2"; got != want {
+		t.Errorf("wrong error counts: want = %q, got = %q", want, got)
+	}
+}
+
+// timeoutError is a net.Error of a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errExportsDisabled = errors.New("exports are disabled")
+	errExportName      = errors.New("export must be a name of a file within the export directory")
+	errExportExists    = errors.New("export already exists")
+)
+
+// exportRef references results exported to a file.
+type exportRef struct {
+	// Path is a path of the file within the export directory.
+	Path string `json:"path"`
+	// Rows is a number of exported results, not counting the header row.
+	Rows int `json:"rows"`
+}
+
+// exportPath returns a path of an export of a given name within the export directory.
+//
+// The name must be a plain file name, so the export never escapes the directory,
+// and the file must not exist, so an export never overwrites another one.
+func (h *ResponseSizeCounter) exportPath(name string) (string, error) {
+	if h.exportDir == "" {
+		return "", errExportsDisabled
+	}
+
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.Base(name) != name {
+		return "", fmt.Errorf("'%s': %w", name, errExportName)
+	}
+
+	path := filepath.Join(h.exportDir, name)
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("'%s': %w", name, errExportExists)
+	}
+
+	return path, nil
+}
+
+// export writes given results as CSV to a new file of a given path and returns a reference to it.
+func export(path string, results resultSource) (exportRef, error) {
+	// O_EXCL fails on any existing file, links included, so nothing is written outside the directory
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return exportRef{}, fmt.Errorf("'%s': %w", filepath.Base(path), errExportExists)
+		}
+		return exportRef{}, err
+	}
+
+	counted := &countingSource{resultSource: results}
+	w := bufio.NewWriter(file)
+
+	err = writeCSV(w, counted)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return exportRef{}, err
+	}
+
+	return exportRef{Path: path, Rows: counted.n}, nil
+}
+
+// exportErrorStatus returns a response status of a given error of exporting results.
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errExportsDisabled), errors.Is(err, errExportName):
+		return http.StatusBadRequest
+	case errors.Is(err, errExportExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// exportRefFormat returns a JSON format writing a given reference instead of results.
+func exportRefFormat(ref exportRef) format {
+	return format{
+		contentType: jsonFormat.contentType,
+		write: func(w io.Writer, _ resultSource) error {
+			return json.NewEncoder(w).Encode(ref)
+		},
+	}
+}
+
+// countingSource is a resultSource counting results it goes through.
+type countingSource struct {
+	resultSource
+	n int
+}
+
+func (s *countingSource) each(fn func(res Result) error) error {
+	s.n = 0
+
+	return s.resultSource.each(func(res Result) error {
+		s.n++
+		return fn(res)
+	})
+}
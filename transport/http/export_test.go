@@ -0,0 +1,129 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func exportRequest(name string) *http.Request {
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: net_url.Values{"export": {name}}.Encode()},
+		Body:   io.NopCloser(strings.NewReader("https://test-1.com\nhttps://test-22.com")),
+	}
+}
+
+func TestWithExportDir(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+		}, nil
+	}).Times(2)
+
+	dir := t.TempDir()
+
+	handler := newResponseSizeCounter(t, WithExportDir(dir))
+	handler.SetClient(client)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, exportRequest("results.csv"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var ref exportRef
+	if err := json.NewDecoder(w.Body).Decode(&ref); err != nil {
+		t.Fatalf("cannot decode export reference: %s", err)
+	}
+
+	want := exportRef{Path: filepath.Join(dir, "results.csv"), Rows: 2}
+	if ref != want {
+		t.Errorf("wrong export reference: want = %+v, got = %+v", want, ref)
+	}
+
+	file, err := os.Open(ref.Path)
+	if err != nil {
+		t.Fatalf("cannot open export: %s", err)
+	}
+	defer closeFile(file)
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("cannot read export: %s", err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("wrong number of rows: want = %d, got = %d", 3, len(rows))
+	}
+
+	for i, want := range [][]string{{"url", "size"}, {"https://test-1.com", "10"}, {"https://test-22.com", "11"}} {
+		if rows[i][0] != want[0] || rows[i][1] != want[1] {
+			t.Errorf("wrong row #%d: want = %v, got = %v", i, want, rows[i][:2])
+		}
+	}
+}
+
+func TestWithExportDir_rejected(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "exists.csv"), nil, 0o644); err != nil {
+		t.Fatalf("cannot create export: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		dir    string
+		export string
+		status int
+	}{
+		{name: "disabled", export: "results.csv", status: http.StatusBadRequest},
+		{name: "parent", dir: dir, export: "../results.csv", status: http.StatusBadRequest},
+		{name: "dot-dot", dir: dir, export: "..", status: http.StatusBadRequest},
+		{name: "nested", dir: dir, export: "nested/results.csv", status: http.StatusBadRequest},
+		{name: "absolute", dir: dir, export: "/tmp/results.csv", status: http.StatusBadRequest},
+		{name: "existing", dir: dir, export: "exists.csv", status: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// nothing is fetched for a rejected export
+			client := http_mock.NewMockClient(ctrl)
+
+			handler := newResponseSizeCounter(t, WithExportDir(tt.dir))
+			handler.SetClient(client)
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, exportRequest(tt.export))
+
+			if w.Code != tt.status {
+				t.Errorf("wrong status: want = %d, got = %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("export escaped its directory: %v", entries)
+	}
+}
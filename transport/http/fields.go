@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// field is a field of results able to be selected for CSV and JSON output.
+type field struct {
+	name string
+	// json returns a value of the field rendered in JSON.
+	json func(res Result) interface{}
+	// text returns a value of the field rendered in CSV.
+	text func(res Result) string
+}
+
+// resultFields maps names of fields accepted by 'fields' query parameter to fields.
+//
+// Durations are in nanoseconds in JSON and formatted as Go durations in CSV, the same as of the whole results.
+var resultFields = map[string]field{
+	"url": {
+		json: func(res Result) interface{} { return res.URL },
+		text: func(res Result) string { return res.URL },
+	},
+	"size": {
+		json: func(res Result) interface{} { return res.Size },
+		text: func(res Result) string { return strconv.Itoa(res.Size) },
+	},
+	"status": {
+		json: func(res Result) interface{} { return res.status },
+		text: func(res Result) string { return strconv.Itoa(res.status) },
+	},
+	"latency": {
+		json: func(res Result) interface{} { return res.Latency },
+		text: func(res Result) string { return res.Latency.String() },
+	},
+	"ttfb": {
+		json: func(res Result) interface{} { return res.TTFB },
+		text: func(res Result) string { return res.TTFB.String() },
+	},
+	"dns": {
+		json: func(res Result) interface{} { return res.DNS },
+		text: func(res Result) string { return res.DNS.String() },
+	},
+	"error": {
+		json: func(res Result) interface{} { return res.Error },
+		text: func(res Result) string { return res.Error },
+	},
+	"error_class": {
+		json: func(res Result) interface{} { return res.ErrorClass },
+		text: func(res Result) string { return res.ErrorClass },
+	},
+	"skipped": {
+		json: func(res Result) interface{} { return res.Skipped },
+		text: func(res Result) string { return res.Skipped },
+	},
+	"hash": {
+		json: func(res Result) interface{} { return res.Hash },
+		text: func(res Result) string { return res.Hash },
+	},
+	"proto": {
+		json: func(res Result) interface{} { return res.Proto },
+		text: func(res Result) string { return res.Proto },
+	},
+	"truncated": {
+		json: func(res Result) interface{} { return res.Truncated },
+		text: func(res Result) string { return strconv.FormatBool(res.Truncated) },
+	},
+}
+
+// fieldList is a list of fields selected for output, in the order they are rendered in.
+type fieldList []field
+
+// parseFields returns fields of given names, which must be known and distinct.
+func parseFields(names []string) (fieldList, error) {
+	fl := make(fieldList, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		f, ok := resultFields[name]
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a known field", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("'%s' is selected more than once", name)
+		}
+		seen[name] = true
+
+		f.name = name
+		fl = append(fl, f)
+	}
+
+	return fl, nil
+}
+
+// fieldsParam returns fields selected with 'fields' query parameter of a given request, separated by commas,
+// e.g. '?fields=url,status,size'. No fields are selected if the parameter is absent.
+func fieldsParam(req *http.Request) (fieldList, error) {
+	param := queryParam(req, "fields")
+	if param == "" {
+		return nil, nil
+	}
+
+	names := strings.Split(param, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+
+	return parseFields(names)
+}
+
+// format returns a given format rendering only the fields, false if the format is neither JSON nor CSV one.
+func (fl fieldList) format(f format) (format, bool) {
+	switch f.contentType {
+	case jsonFormat.contentType:
+		return format{contentType: f.contentType, write: func(w io.Writer, results resultSource) error {
+			if err := writeJSONArray(w, results, fl.marshal); err != nil {
+				return err
+			}
+
+			_, err := io.WriteString(w, "\n")
+			return err
+		}}, true
+	case csvFormat.contentType:
+		return format{contentType: f.contentType, write: fl.writeCSV}, true
+	default:
+		return f, false
+	}
+}
+
+// marshal encodes a given result as a JSON object holding the fields in their order,
+// or the whole result if no fields are selected.
+func (fl fieldList) marshal(res Result) ([]byte, error) {
+	if len(fl) == 0 {
+		return marshalResult(res)
+	}
+
+	b := []byte{'{'}
+	for i, f := range fl {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		value, err := json.Marshal(f.json(res))
+		if err != nil {
+			return nil, err
+		}
+
+		b = strconv.AppendQuote(b, f.name)
+		b = append(b, ':')
+		b = append(b, value...)
+	}
+
+	return append(b, '}'), nil
+}
+
+// writeCSV writes results as CSV rows of the fields preceded by a header row of their names.
+func (fl fieldList) writeCSV(w io.Writer, results resultSource) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, 0, len(fl))
+	for _, f := range fl {
+		header = append(header, f.name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(fl))
+	err := results.each(func(res Result) error {
+		for i, f := range fl {
+			row[i] = f.text(res)
+		}
+		return cw.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
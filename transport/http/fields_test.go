@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_fields(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		query  string
+		status int
+		body   string
+	}{
+		{
+			name:   "csv subset",
+			query:  "format=csv&fields=status,url",
+			status: http.StatusOK,
+			body:   "status,url\n200,https://test-1.com\n",
+		},
+		{
+			name:   "json subset",
+			query:  "format=json&fields=size, url",
+			status: http.StatusOK,
+			body:   `[{"size":25000,"url":"https://test-1.com"}]` + "\n",
+		},
+		{
+			name:   "json with summary",
+			query:  "format=json&fields=url&summary=true",
+			status: http.StatusOK,
+			body:   `{"results":[{"url":"https://test-1.com"}],"summary":`,
+		},
+		{
+			name:   "default fields",
+			opts:   []Option{WithFields("url", "size")},
+			query:  "format=csv",
+			status: http.StatusOK,
+			body:   "url,size\nhttps://test-1.com,25000\n",
+		},
+		{
+			name:   "default fields overridden",
+			opts:   []Option{WithFields("url", "size")},
+			query:  "format=csv&fields=size",
+			status: http.StatusOK,
+			body:   "size\n25000\n",
+		},
+		{
+			name:   "default fields of other format",
+			opts:   []Option{WithFields("url")},
+			query:  "format=text",
+			status: http.StatusOK,
+			body:   "25000",
+		},
+		{
+			name:   "unknown field",
+			query:  "format=csv&fields=url,color",
+			status: http.StatusBadRequest,
+			body:   "'color' is not a known field",
+		},
+		{
+			name:   "duplicate field",
+			query:  "format=json&fields=url,url",
+			status: http.StatusBadRequest,
+			body:   "'url' is selected more than once",
+		},
+		{
+			name:   "unsupported format",
+			query:  "format=text&fields=url",
+			status: http.StatusBadRequest,
+			body:   "'fields' is supported by csv and json formats only",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			if tt.status == http.StatusOK {
+				client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+			}
+
+			handler := newResponseSizeCounter(t, tt.opts...)
+			handler.SetClient(client)
+
+			req := requestWithAccept("https://test-1.com", "")
+			req.URL = &net_url.URL{RawQuery: tt.query}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("wrong response status: want = %d, got = %d: %s", tt.status, w.Code, w.Body)
+			}
+
+			// error messages follow a prefix naming the failed step
+			matches := strings.HasPrefix
+			if tt.status != http.StatusOK {
+				matches = strings.Contains
+			}
+
+			if got := w.Body.String(); !matches(got, tt.body) {
+				t.Errorf("wrong response body: want = %q, got = %q", tt.body, got)
+			}
+		})
+	}
+}
+
+func TestWithFields_invalid(t *testing.T) {
+	for _, names := range [][]string{{"url", "colour"}, {"size", "size"}} {
+		if _, err := NewResponseSizeCounter(WithFields(names...)); !errors.Is(err, errInvalidOption) {
+			t.Errorf("fields %v: wrong error: want = %v, got = %v", names, errInvalidOption, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fileScheme is a scheme of URLs of local files, e.g. file:///reports/daily.json.
+const fileScheme = "file"
+
+// fileTransport is an implementation of http.RoundTripper reading local files within a root directory.
+//
+// A path of a file URL is resolved against the root, so files outside of it are never read.
+type fileTransport struct {
+	root string
+}
+
+func newFileTransport(root string) *fileTransport {
+	return &fileTransport{root: root}
+}
+
+// RoundTrip responds with a content of a file given within a request URL.
+func (t *fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, err := t.resolve(req.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		closeFile(file)
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		closeFile(file)
+		return nil, fmt.Errorf("'%s' is not a regular file", req.URL.Path)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        make(http.Header),
+		ContentLength: info.Size(),
+		Body:          file,
+		Request:       req,
+	}, nil
+}
+
+// resolve returns a path of a file within the root, failing if the file, or a link to it, escapes the root.
+func (t *fileTransport) resolve(urlPath string) (string, error) {
+	root, err := filepath.EvalSymlinks(t.root)
+	if err != nil {
+		return "", fmt.Errorf("resolve root: %s", err)
+	}
+
+	// cleaning a rooted path drops every '..' climbing above the root
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+urlPath))))
+	if err != nil {
+		return "", err
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside of the root", urlPath)
+	}
+
+	return resolved, nil
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Printf("close file: %s", err)
+	}
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithLocalFiles(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "report.json"), []byte(strings.Repeat("0", 100)), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatalf("cannot create symbolic link: %s", err)
+	}
+
+	rel, err := filepath.Rel(root, filepath.Join(outside, "secret"))
+	if err != nil {
+		t.Fatalf("cannot get relative path: %s", err)
+	}
+
+	handler := newResponseSizeCounter(t, WithLocalFiles(root))
+
+	result, err := handler.do(context.Background(), target{URL: "file:///report.json"})
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+
+	if result.Size != 100 {
+		t.Errorf("wrong file size: want = %d, got = %d", 100, result.Size)
+	}
+
+	for _, url := range []string{
+		"file:///missing.json",
+		"file:///" + filepath.ToSlash(rel),
+		"file:///link",
+		"file:///",
+	} {
+		if result, err := handler.do(context.Background(), target{URL: url}); err == nil {
+			t.Errorf("%s is read: %+v", url, result)
+		}
+	}
+}
+
+func TestWithLocalFiles_twice(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(second, "report.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	// the last root is used
+	handler := newResponseSizeCounter(t, WithLocalFiles(first), WithLocalFiles(second))
+
+	result, err := handler.do(context.Background(), target{URL: "file:///report.json"})
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+
+	if result.Size != 2 {
+		t.Errorf("wrong file size: want = %d, got = %d", 2, result.Size)
+	}
+}
+
+func TestWithLocalFiles_redirect(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "report.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	srv := httptest.NewServer(http.RedirectHandler("file:///report.json", http.StatusFound))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithLocalFiles(root))
+
+	if _, err := handler.do(context.Background(), target{URL: srv.URL}); !errors.Is(err, errFileRedirect) {
+		t.Errorf("wrong error: want = %v, got = %v", errFileRedirect, err)
+	}
+}
+
+func TestWithLocalFiles_disabled(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "report.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	handler := newResponseSizeCounter(t)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "format=json"},
+		Body:   io.NopCloser(strings.NewReader("file://" + filepath.ToSlash(filepath.Join(root, "report.json")))),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 1 || results[0].Error == "" {
+		t.Errorf("file is read by default: %+v", results)
+	}
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// format describes a representation the results can be rendered in.
+type format struct {
+	contentType string
+	write       func(w io.Writer, results resultSource) error
+}
+
+// resultSource provides results to be rendered one by one.
+type resultSource interface {
+	each(fn func(res Result) error) error
+}
+
+// resultSlice is a resultSource of results held in memory.
+type resultSlice []Result
+
+func (rs resultSlice) each(fn func(res Result) error) error {
+	for _, res := range rs {
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	textFormat   = format{contentType: "text/plain; charset=utf-8", write: writeText}
+	jsonFormat   = format{contentType: "application/json", write: writeJSON}
+	csvFormat    = format{contentType: "text/csv", write: writeCSV}
+	ndjsonFormat = format{contentType: "application/x-ndjson", write: writeNDJSON}
+	// protobufFormat renders a Results message of results.proto.
+	protobufFormat = format{contentType: "application/x-protobuf", write: writeProtobuf}
+
+	// humanTextFormat is a plain text format with sizes in IEC units.
+	humanTextFormat = format{contentType: textFormat.contentType, write: writeHumanText}
+)
+
+// formats maps names of formats accepted by 'format' query parameter to formats.
+var formats = map[string]format{
+	"text":     textFormat,
+	"json":     jsonFormat,
+	"csv":      csvFormat,
+	"ndjson":   ndjsonFormat,
+	"protobuf": protobufFormat,
+	"html":     htmlFormat,
+}
+
+// negotiateFormat picks an output format by the Accept header of a given request.
+//
+// Plain text is used when the header is absent or holds no supported media type.
+func negotiateFormat(req *http.Request) format {
+	for _, accepted := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json":
+			return jsonFormat
+		case "text/csv":
+			return csvFormat
+		case "application/x-ndjson":
+			return ndjsonFormat
+		case "application/x-protobuf":
+			return protobufFormat
+		case "text/html":
+			return htmlFormat
+		case "text/plain":
+			return textFormat
+		}
+	}
+
+	return textFormat
+}
+
+// writeText writes responses bodies lengths in bytes separated by a new line.
+func writeText(w io.Writer, results resultSource) error {
+	return writeLines(w, results, func(res Result) string {
+		return strconv.Itoa(res.Size)
+	})
+}
+
+// writeHumanText writes responses bodies lengths in IEC units separated by a new line.
+func writeHumanText(w io.Writer, results resultSource) error {
+	return writeLines(w, results, func(res Result) string {
+		return humanSize(res.Size)
+	})
+}
+
+// writeLines writes a line for each result, lines are separated by a new line.
+func writeLines(w io.Writer, results resultSource, line func(res Result) string) error {
+	sep := ""
+
+	return results.each(func(res Result) error {
+		_, err := io.WriteString(w, sep+line(res))
+		sep = "\n"
+		return err
+	})
+}
+
+// humanSize formats a given number of bytes with IEC units, e.g. 25000 is formatted as "24.4 KiB".
+func humanSize(size int) string {
+	const unit = 1024
+
+	if size < unit {
+		return strconv.Itoa(size) + " B"
+	}
+
+	// a unit is chosen by a rounded value, so 1048575 is formatted as "1.0 MiB" rather than "1024.0 KiB"
+	value, exp := float64(size)/unit, 0
+	for math.Round(value*10)/10 >= unit && exp < 5 {
+		value /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
+
+// writeJSON writes results as a JSON array, an empty one if there are no results.
+func writeJSON(w io.Writer, results resultSource) error {
+	if err := writeJSONArray(w, results, marshalResult); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// objectJSONFormat returns a JSON format writing results encoded by a given function as a JSON object
+// along with given fields, e.g. a summary of the results.
+func objectJSONFormat(fields map[string]interface{}, marshal func(res Result) ([]byte, error)) format {
+	return format{
+		contentType: jsonFormat.contentType,
+		write: func(w io.Writer, results resultSource) error {
+			if _, err := io.WriteString(w, `{"results":`); err != nil {
+				return err
+			}
+
+			if err := writeJSONArray(w, results, marshal); err != nil {
+				return err
+			}
+
+			// fields follow results in the object the marshaled map opens
+			b, err := json.Marshal(fields)
+			if err != nil {
+				return err
+			}
+
+			if len(fields) > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+
+			_, err = io.WriteString(w, string(b[1:])+"\n")
+			return err
+		},
+	}
+}
+
+// marshalResult encodes a given result as a JSON object holding all of its fields.
+func marshalResult(res Result) ([]byte, error) {
+	return json.Marshal(res)
+}
+
+// writeJSONArray writes results encoded by a given function as a JSON array with no trailing new line.
+func writeJSONArray(w io.Writer, results resultSource, marshal func(res Result) ([]byte, error)) error {
+	sep := "["
+
+	err := results.each(func(res Result) error {
+		b, err := marshal(res)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if sep == "[" {
+		_, err = io.WriteString(w, "[]")
+	} else {
+		_, err = io.WriteString(w, "]")
+	}
+
+	return err
+}
+
+// writeNDJSON writes results as JSON objects separated by a new line.
+func writeNDJSON(w io.Writer, results resultSource) error {
+	enc := json.NewEncoder(w)
+
+	return results.each(func(res Result) error {
+		return enc.Encode(res)
+	})
+}
+
+// writeCSV writes results as CSV rows preceded by a header row, which is written even if there are no results.
+func writeCSV(w io.Writer, results resultSource) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"url", "size", "latency", "ttfb"}); err != nil {
+		return err
+	}
+
+	err := results.each(func(res Result) error {
+		return cw.Write([]string{res.URL, strconv.Itoa(res.Size), res.Latency.String(), res.TTFB.String()})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,221 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_emptyUrls(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{name: "text", accept: "", contentType: "text/plain; charset=utf-8", body: ""},
+		{name: "json", accept: "application/json", contentType: "application/json", body: "[]\n"},
+		{name: "csv", accept: "text/csv", contentType: "text/csv", body: "url,size,latency,ttfb\n"},
+		{name: "ndjson", accept: "application/x-ndjson", contentType: "application/x-ndjson", body: ""},
+		{name: "protobuf", accept: "application/x-protobuf", contentType: "application/x-protobuf", body: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			handler := &ResponseSizeCounter{
+				client: http_mock.NewMockClient(ctrl),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, requestWithAccept("\n\n", tt.accept))
+
+			res := w.Result()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+			}
+			defer closeResBody(res.Body)
+
+			if got := res.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("wrong content type: want = %s, got = %s", tt.contentType, got)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Errorf("cannot read response body: %s", err)
+			}
+
+			if string(body) != tt.body {
+				t.Errorf("wrong response body: want = %q, got = %q", tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_formatParam(t *testing.T) {
+	tests := []struct {
+		format      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{format: "text", status: http.StatusOK, contentType: "text/plain; charset=utf-8", body: "25000"},
+		{format: "json", status: http.StatusOK, contentType: "application/json", body: "[{\"url\":\"https://test-1.com\",\"size\":25000"},
+		{format: "csv", status: http.StatusOK, contentType: "text/csv", body: "url,size,latency,ttfb\nhttps://test-1.com,25000,"},
+		{format: "ndjson", status: http.StatusOK, contentType: "application/x-ndjson", body: "{\"url\":\"https://test-1.com\",\"size\":25000"},
+		{format: "html", status: http.StatusOK, contentType: "text/html; charset=utf-8", body: "<!DOCTYPE html>"},
+		{format: "xml", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.format, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			if tt.status == http.StatusOK {
+				client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+			}
+
+			handler := &ResponseSizeCounter{
+				client: client,
+			}
+
+			// the query parameter takes precedence over the Accept header
+			req := requestWithAccept("https://test-1.com", "application/json")
+			req.URL = &net_url.URL{RawQuery: "format=" + tt.format}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			res := w.Result()
+			if res.StatusCode != tt.status {
+				t.Fatalf("wrong response status: want = %d, got = %d", tt.status, res.StatusCode)
+			}
+			defer closeResBody(res.Body)
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			if got := res.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("wrong content type: want = %s, got = %s", tt.contentType, got)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Errorf("cannot read response body: %s", err)
+			}
+
+			if !strings.HasPrefix(string(body), tt.body) {
+				t.Errorf("wrong response body: want prefix = %q, got = %q", tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1024, want: "1.0 KiB"},
+		{size: 25000, want: "24.4 KiB"},
+		{size: 1024*1024 - 52, want: "1023.9 KiB"},
+		{size: 1024*1024 - 1, want: "1.0 MiB"},
+		{size: 1024 * 1024, want: "1.0 MiB"},
+		{size: 5*1024*1024*1024 + 512*1024*1024, want: "5.5 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := humanSize(tt.size); got != tt.want {
+			t.Errorf("wrong human size of %d: want = %s, got = %s", tt.size, tt.want, got)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_humanUnits(t *testing.T) {
+	tests := []struct {
+		query string
+		body  string
+	}{
+		{query: "units=human", body: "24.4 KiB"},
+		{query: "units=human&format=csv", body: "url,size,latency,ttfb\nhttps://test-1.com,25000,"},
+	}
+
+	for _, tt := range tests {
+		ctrl := gomock.NewController(t)
+
+		client := http_mock.NewMockClient(ctrl)
+		{
+			client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+		}
+
+		handler := &ResponseSizeCounter{
+			client: client,
+		}
+
+		req := requestWithAccept("https://test-1.com", "")
+		req.URL = &net_url.URL{RawQuery: tt.query}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if body := w.Body.String(); !strings.HasPrefix(body, tt.body) {
+			t.Errorf("wrong response body for '%s': want prefix = %q, got = %q", tt.query, tt.body, body)
+		}
+
+		ctrl.Finish()
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: textFormat.contentType},
+		{accept: "text/plain", want: textFormat.contentType},
+		{accept: "application/json", want: jsonFormat.contentType},
+		{accept: "image/png, application/json;q=0.9", want: jsonFormat.contentType},
+		{accept: "text/html,application/xhtml+xml", want: htmlFormat.contentType},
+		{accept: "text/csv", want: csvFormat.contentType},
+		{accept: "application/x-ndjson", want: ndjsonFormat.contentType},
+		{accept: "image/png", want: textFormat.contentType},
+	}
+
+	for _, tt := range tests {
+		got := negotiateFormat(requestWithAccept("", tt.accept))
+		if got.contentType != tt.want {
+			t.Errorf("wrong format for '%s': want = %s, got = %s", tt.accept, tt.want, got.contentType)
+		}
+	}
+}
+
+func requestWithAccept(body, accept string) *http.Request {
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: make(http.Header),
+		Body:   io.NopCloser(bytes.NewBufferString(body)),
+	}
+	req.Header.Set("Accept", accept)
+
+	return req
+}
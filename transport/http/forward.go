@@ -0,0 +1,37 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// forwardedHeaderKey is a context key of incoming request headers forwarded to outbound requests.
+type forwardedHeaderKey struct{}
+
+// withForwardedHeader returns a copy of a given request carrying its headers of given names
+// to be forwarded to outbound requests.
+func withForwardedHeader(req *http.Request, names []string) *http.Request {
+	forwarded := make(http.Header)
+	for _, name := range names {
+		// every value of a multi-valued header is forwarded, e.g. of several Cookie headers
+		for _, value := range req.Header.Values(name) {
+			forwarded.Add(name, value)
+		}
+	}
+
+	if len(forwarded) == 0 {
+		return req
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), forwardedHeaderKey{}, forwarded))
+}
+
+// forwardHeader adds headers forwarded from an incoming request, if any, to a given outbound one.
+func forwardHeader(ctx context.Context, req *http.Request) {
+	forwarded, _ := ctx.Value(forwardedHeaderKey{}).(http.Header)
+	for name, values := range forwarded {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithForwardedHeaders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		if got := req.Header.Values("Cookie"); strings.Join(got, "; ") != "a=1; b=2" {
+			t.Errorf("wrong forwarded Cookie headers: want = %v, got = %v", []string{"a=1", "b=2"}, got)
+		}
+
+		if got := req.Header.Get("X-Request-Id"); got != "42" {
+			t.Errorf("wrong forwarded X-Request-Id header: want = %s, got = %s", "42", got)
+		}
+
+		if got := req.Header.Get("Authorization"); got != "" {
+			t.Errorf("not listed header is forwarded: %s", got)
+		}
+
+		return response(http.StatusOK), nil
+	}).Times(3)
+
+	handler := newResponseSizeCounter(t, WithForwardedHeaders("Cookie", "X-Request-Id"))
+	handler.SetClient(client)
+
+	req := request()
+	req.Header = http.Header{}
+	req.Header.Add("Cookie", "a=1")
+	req.Header.Add("Cookie", "b=2")
+	req.Header.Set("X-Request-Id", "42")
+	req.Header.Set("Authorization", "Bearer abc")
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusOK, w.Code)
+	}
+}
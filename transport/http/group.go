@@ -0,0 +1,62 @@
+package http
+
+import (
+	"sync"
+)
+
+// errGroup runs functions concurrently and collects the first error of them.
+// It mirrors errgroup.Group of golang.org/x/sync/errgroup package without a context,
+// which is not a dependency of the module: functions are not cancelled by an error of another one.
+type errGroup struct {
+	wg  sync.WaitGroup
+	sem chan struct{}
+
+	errOnce sync.Once
+	err     error
+}
+
+// setLimit limits the number of active goroutines in the group to at most n.
+// A non-positive value indicates no limit. It must not be called while any goroutines are active.
+func (g *errGroup) setLimit(n int) {
+	if n <= 0 {
+		g.sem = nil
+		return
+	}
+
+	g.sem = make(chan struct{}, n)
+}
+
+// Go calls the given function in a new goroutine, blocking until it can be added
+// without the number of active goroutines exceeding the limit.
+func (g *errGroup) Go(fn func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+
+		if err := fn(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+			})
+		}
+	}()
+}
+
+// Wait blocks until all function calls from the Go method have returned,
+// then returns the first non-nil error (if any) from them.
+func (g *errGroup) Wait() error {
+	g.wg.Wait()
+
+	return g.err
+}
+
+func (g *errGroup) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+
+	g.wg.Done()
+}
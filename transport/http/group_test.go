@@ -0,0 +1,71 @@
+package http
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestErrGroup_firstError(t *testing.T) {
+	var g errGroup
+
+	wantErr := errors.New("first")
+
+	var calls int32
+	g.Go(func() error {
+		atomic.AddInt32(&calls, 1)
+		return wantErr
+	})
+	g.Go(func() error {
+		// the rest of functions are not stopped by the error
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&calls, 1)
+		return errors.New("second")
+	})
+
+	if err := g.Wait(); err != wantErr {
+		t.Errorf("wrong group error: want = %v, got = %v", wantErr, err)
+	}
+
+	if calls != 2 {
+		t.Errorf("wrong calls count: want = %d, got = %d", 2, calls)
+	}
+}
+
+func TestErrGroup_success(t *testing.T) {
+	var g errGroup
+	g.setLimit(2)
+
+	var active, maxActive, calls int32
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&calls, 1)
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		t.Errorf("unexpected group error: %s", err)
+	}
+
+	if calls != 10 {
+		t.Errorf("wrong calls count: want = %d, got = %d", 10, calls)
+	}
+
+	if maxActive > 2 {
+		t.Errorf("limit exceeded: want at most %d active, got = %d", 2, maxActive)
+	}
+}
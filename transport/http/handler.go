@@ -2,16 +2,26 @@ package http
 
 import (
 	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	net_url "net/url"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 const (
@@ -19,68 +29,421 @@ const (
 	defaultLimitDuration = time.Second
 )
 
-// resSizes holds a slice of byte lengths of responses bodies.
-type resSizes struct {
-	mu sync.Mutex
-	s  []int
-}
+// adminRealm is a realm of HTTP basic authentication of admin endpoints MakeResponseSizeCounter serves.
+const adminRealm = "sample-handler admin"
 
-// String returns a string representation of resSizes:
-// strings with responses bodies lengths in bytes separated by a new line.
-func (rs *resSizes) String() string {
-	b := strings.Builder{}
+// defaultAllFailedStatus is a response status used when every fetched URL fails.
+const defaultAllFailedStatus = http.StatusBadGateway
 
-	sLen := len(rs.s)
-	for i, size := range rs.s {
-		b.WriteString(strconv.Itoa(size))
-		if sLen-i > 1 {
-			b.WriteString("\n")
-		}
-	}
+// skippedByType is a reason of skipping responses not matching content types the handler counts.
+const skippedByType = "type"
+
+// skippedBySize is a reason of skipping responses advertising a Content-Length over the size gate.
+const skippedBySize = "size"
+
+// effectiveURLHeader is a response header holding, one value per URL, the URLs the handler acted on.
+const effectiveURLHeader = "X-Effective-Url"
+
+// Result holds a byte length of a response body received from a URL.
+type Result struct {
+	URL  string `json:"url"`
+	Size int    `json:"size"`
+
+	// Latency is a time spent to fetch the URL, in nanoseconds when rendered as JSON.
+	Latency time.Duration `json:"latency"`
+	// TTFB is a time to the first byte of the response, in nanoseconds when rendered as JSON.
+	TTFB time.Duration `json:"ttfb"`
+	// DNS is a time spent resolving hosts of the URL and of its redirects, in nanoseconds when rendered as JSON,
+	// set if DNS timing is enabled. It is zero if connections are reused or hosts are IP addresses.
+	DNS time.Duration `json:"dns,omitempty"`
+
+	// Error describes why the URL failed to be fetched, if it did.
+	Error string `json:"error,omitempty"`
+	// Skipped is a reason the URL was not fetched at all, if it wasn't.
+	Skipped string `json:"skipped,omitempty"`
+	// ErrorClass categorizes a failure of the fetch, e.g. "timeout", "dns" or "http_5xx"
+	// for a response of a server error status, which doesn't fail the fetch otherwise.
+	ErrorClass string `json:"error_class,omitempty"`
+
+	// Hash is a hex-encoded SHA-256 hash of the response body, set if hashing is enabled.
+	Hash string `json:"hash,omitempty"`
+
+	// Proto is a protocol version of the final response, e.g. "HTTP/1.1".
+	Proto string `json:"proto,omitempty"`
+
+	// SchemeDowngrade reports whether the URL redirected from https to http, set if such redirects are flagged.
+	SchemeDowngrade bool `json:"scheme_downgrade,omitempty"`
 
-	return b.String()
+	// Request describes the outbound request performed to fetch the URL, set if recording is enabled.
+	Request *RecordedRequest `json:"request,omitempty"`
+
+	// Expected is a size the URL is expected to respond with, set if the request asks to check it.
+	Expected *int `json:"expected,omitempty"`
+	// Matched reports whether the size is the expected one.
+	Matched bool `json:"matched,omitempty"`
+
+	// order is a position of the URL within the request, results are collected and sorted by it.
+	order int
+	// status is a status code of the response, zero if there is none.
+	status int
+
+	// Truncated reports whether the response body exceeded the maximum size and was counted up to it.
+	Truncated bool `json:"truncated,omitempty"`
+	// AdvertisedSize is a Content-Length of a truncated response, zero if it is unknown,
+	// of a response skipped as it is over the size gate or of a response with a body of other length.
+	AdvertisedSize int64 `json:"advertised_size,omitempty"`
+	// LengthMismatch reports whether the response body is of other length than its Content-Length,
+	// which is a sign of a broken origin.
+	LengthMismatch bool `json:"length_mismatch,omitempty"`
+	// ReceivedSize is a length of the body of a response with mismatched length.
+	ReceivedSize int64 `json:"received_size,omitempty"`
+	// ReadError reports whether reading the response body failed partway, e.g. as the connection was reset.
+	// Size of such a result is zero, bytes read before the failure are reported as PartialSize.
+	ReadError bool `json:"read_error,omitempty"`
+	// PartialSize is a number of bytes of the response body read before reading it failed.
+	PartialSize int64 `json:"partial_size,omitempty"`
+
+	// Attempts describes each attempt of fetching the URL, set if retries are enabled.
+	Attempts []Attempt `json:"attempts,omitempty"`
+
+	// Timings is a waterfall of phases of the fetch, set if timings are enabled.
+	Timings *Timings `json:"timings,omitempty"`
+
+	// ConnectionCounts holds numbers of connections opened and reused to fetch the URL, redirects included,
+	// set if connection tracing is enabled.
+	*ConnectionCounts
 }
 
-// Add appends a byte length of response body to resSizes.
-func (rs *resSizes) Add(i int) {
-	rs.mu.Lock()
-	defer rs.mu.Unlock()
+// resSizes holds results of performed requests, each of them at a position of its URL within a request.
+//
+// Results of different positions are able to be added concurrently without locking,
+// as every result has a slot of its own.
+type resSizes struct {
+	s []Result
+}
 
-	rs.s = append(rs.s, i)
+func newResSizes(n int) *resSizes {
+	return &resSizes{s: make([]Result, n)}
 }
 
-// Getter is a contract for performing HTTP GET requests.
+// Add puts a result of a performed request to its slot.
+func (rs *resSizes) Add(res Result) {
+	rs.s[res.order] = res
+}
+
+// Results returns the collected results in the order of their URLs within a request.
+// It must not be called until every result is added.
+//
+// The returned slice is never nil, so it is rendered as an empty list by every output format.
+func (rs *resSizes) Results() []Result {
+	return rs.s
+}
+
+// Getter is a contract for performing outbound HTTP requests.
 //
 // Standart http.Client satisfies Getter interface.
 type Getter interface {
-	Get(url string) (resp *http.Response, err error)
+	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 // ResponseSizeCounter is an implementation of http.Handler.
 type ResponseSizeCounter struct {
-	urls  []string
-	sizes resSizes
+	// metrics counts requests and fetched URLs, it goes first to be aligned for atomic access.
+	metrics metrics
+	// metricsEndpoint makes MakeResponseSizeCounter serve the metrics.
+	metricsEndpoint bool
+	// requestsCounted is set if requests are counted by a handler wrapping the whole mux
+	// of MakeResponseSizeCounter, so ServeHTTP doesn't count them once again.
+	requestsCounted bool
+	// adminCredentials are usernames and passwords of operators allowed to reset the rate limit,
+	// MakeResponseSizeCounter serves the reset endpoint if they are set.
+	adminCredentials map[string]string
+	// started is a time the handler is created at.
+	started time.Time
+
+	clientMu sync.RWMutex
+	client   Getter
+
+	// transport is an underlying transport of the default client, configured by options.
+	// It is shared by all served requests, so they share its pool of kept-alive connections.
+	transport *http.Transport
+	// dialer dials connections of the transport, refusing non-public addresses of requests marked with publicOnlyKey.
+	dialer *net.Dialer
+	// caBundles holds pools of root certificates requests are able to select by name.
+	caBundles map[string]*x509.CertPool
+	// localFiles reads local files of file URLs, if set.
+	localFiles *fileTransport
+	// unixSockets holds paths of Unix domain sockets URLs of http+unix scheme are allowed to reach.
+	unixSockets []string
+
+	// hashBodies enables hashing of responses bodies.
+	hashBodies bool
+
+	// namedLists holds URL lists requests are able to refer to by name.
+	namedLists map[string][]string
+
+	// commentPrefix marks lines of a request body to be skipped, if set.
+	commentPrefix string
+	// strictLines makes blank lines of a request body invalid instead of being skipped.
+	strictLines bool
+	// maxRequestSize limits a size of a request body, decompressed one if it is compressed, if set.
+	maxRequestSize int64
+	// keepSpace disables trimming of whitespaces surrounding lines of a request body.
+	keepSpace bool
+	// maxLineLength is a maximum length of a line of a request body in bytes, the default one if it is not positive.
+	maxLineLength int
+
+	// requestHooks are called with each outbound request before it is sent.
+	requestHooks []func(req *http.Request)
+
+	// responseHooks are called with each response before its body is read.
+	responseHooks []func(res *http.Response)
+
+	// traceConnections enables counting connections opened and reused by fetches.
+	traceConnections bool
+	// timeDNS enables measuring a time of DNS lookups of fetches.
+	timeDNS bool
+	// timings enables measuring a waterfall of phases of fetches.
+	timings bool
+	// recordRequests enables describing outbound requests within results.
+	recordRequests bool
+
+	// maxBodySize limits a number of bytes read from each response body, if set.
+	maxBodySize int64
+	// maxContentLength fails fetches of responses advertising a larger Content-Length, if set.
+	maxContentLength int64
+	// sizeGate skips responses advertising a larger Content-Length, if set.
+	sizeGate int64
+
+	// sort defines an order of results within a response.
+	sort SortOrder
+
+	// cookieJar makes outbound requests of each incoming one share a cookie jar.
+	cookieJar bool
+
+	// forwardHeaders are names of incoming request headers forwarded to outbound requests.
+	forwardHeaders []string
+
+	// accept is a value of Accept header of outbound requests, if set.
+	accept string
+
+	// maxSourceSize limits a size of a list of URLs fetched from a source URL, sources are not fetched if zero.
+	maxSourceSize int64
+
+	// maxRedirects is a number of redirects the default client follows.
+	maxRedirects int
+	// redirectSizeMode defines which responses of a redirect chain count toward a reported size.
+	redirectSizeMode RedirectSizeMode
+	// schemeDowngradeMode defines how redirects from https to http are handled.
+	schemeDowngradeMode SchemeDowngradeMode
+
+	// contentTypes holds prefixes of content types of responses to be counted, all responses are counted if empty.
+	contentTypes []string
+
+	// breaker stops fetching URLs of failing hosts, if set.
+	breaker *circuitBreaker
+
+	// allowedHosts restricts hosts of URLs to be fetched, any host is allowed if empty.
+	allowedHosts hostAllowlist
+
+	// fetchTimeout limits a time of fetching each URL, unless a target overrides it, if set.
+	fetchTimeout time.Duration
+	// maxFetchTimeout limits timeouts targets override, if set.
+	maxFetchTimeout time.Duration
+
+	// adaptive scales a number of URLs each request fetches at the same time to the load, if set.
+	adaptive *adaptiveConcurrency
+
+	// manifest makes the handler return a manifest hash of results of each request.
+	manifest bool
 
-	client Getter
+	// shuffle randomizes an order URLs of a request are fetched in, if set.
+	shuffle *shuffler
+
+	// warmUps is a number of discarded fetches of each URL preceding the measured one.
+	warmUps int
+
+	// retries is a number of times a failed fetch is repeated.
+	retries int
+	// retryDelay is a pause before each repeated fetch.
+	retryDelay time.Duration
+	// retryBudget limits a time of retrying a fetch of each URL, if set.
+	retryBudget time.Duration
+	// retrySizePolicy defines which attempt of a fetch with retries reports its size.
+	retrySizePolicy RetrySizePolicy
+
+	// fetchSem bounds a number of concurrent fetches of all requests, if set.
+	fetchSem chan struct{}
+
+	// spill enables spilling results to a temporary file in spillDir instead of holding them in memory.
+	spill    bool
+	spillDir string
+
+	// exportDir is a directory requests are able to export results to, exports are disabled if it is empty.
+	exportDir string
+
+	// streamBuffer is a number of results waiting to be streamed to a client,
+	// fetches are paused when the buffer is full.
+	streamBuffer int
+	// streamIdleTimeout limits a time of writing each streamed result, if set.
+	streamIdleTimeout time.Duration
+
+	// failFastOnStatus stops fetching URLs of a request once one of them is responded with a non-2xx status.
+	failFastOnStatus bool
+
+	// allFailedStatus is a response status used when every fetched URL fails.
+	allFailedStatus int
+	// mismatchStatus is a response status used when a URL responds with a size other than expected, if set.
+	mismatchStatus int
+
+	// fields are fields of results rendered in CSV and JSON formats unless a request selects others, all if empty.
+	fields fieldList
+
+	// optionErrs are errors of options unable to be applied, reported by NewResponseSizeCounter.
+	optionErrs []error
 }
 
-// MakeResponseSizeCounter returns a new instance of ResponseSizeCounter wrapped in RateLimit middleware.
-func MakeResponseSizeCounter() http.Handler {
-	rateLimitMW := RateLimit(defaultRateLimit, defaultLimitDuration, NewStatHolder())
+// NewResponseSizeCounter returns a new instance of ResponseSizeCounter configured with given options.
+// It fails if the options are invalid, e.g. a limit is negative or options contradict each other.
+func NewResponseSizeCounter(opts ...Option) (*ResponseSizeCounter, error) {
+	// the same as of http.DefaultTransport, along with the check of addresses of list sources
+	dialer := &net.Dialer{
+		Timeout:        30 * time.Second,
+		KeepAlive:      30 * time.Second,
+		ControlContext: publicOnlyControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	client := &http.Client{Transport: transport}
 	rsc := &ResponseSizeCounter{
-		client: http.DefaultClient,
-		sizes:  resSizes{},
+		started:         time.Now(),
+		client:          client,
+		transport:       transport,
+		dialer:          dialer,
+		maxRedirects:    defaultMaxRedirects,
+		streamBuffer:    defaultStreamBuffer,
+		allFailedStatus: defaultAllFailedStatus,
+	}
+	client.CheckRedirect = rsc.checkRedirect
+
+	for _, opt := range opts {
+		opt(rsc)
+	}
+
+	if err := rsc.validate(); err != nil {
+		return nil, err
+	}
+
+	if rsc.localFiles != nil {
+		transport.RegisterProtocol(fileScheme, rsc.localFiles)
+	}
+
+	// the Unix transport is derived once every option has configured the transport
+	if len(rsc.unixSockets) > 0 {
+		transport.RegisterProtocol(unixScheme, newUnixTransport(transport, dialer, rsc.unixSockets))
+	}
+
+	if len(rsc.caBundles) > 0 {
+		client.Transport = newCABundleTransport(transport, rsc.caBundles)
 	}
-	return rateLimitMW(rsc)
+
+	return rsc, nil
+}
+
+// MakeResponseSizeCounter returns a new instance of ResponseSizeCounter configured with given options
+// and wrapped in RateLimit and Gzip middlewares.
+//
+// GET /version is served by VersionHandler bypassing the rate limit,
+// so is GET /metrics by MetricsHandler of the instance, if enabled,
+// and POST /admin/rate-limit/reset by ResetHandler of the rate limiter behind BasicAuth, if enabled.
+//
+// Every request is counted as served by the instance, whatever route it takes or status it gets.
+//
+// It panics if the options are invalid, see NewResponseSizeCounter.
+func MakeResponseSizeCounter(opts ...Option) http.Handler {
+	rateLimiter := NewRateLimiter(defaultRateLimit, defaultLimitDuration, NewStatHolder())
+	gzipMW := Gzip(gzip.DefaultCompression)
+
+	rsc, err := NewResponseSizeCounter(opts...)
+	if err != nil {
+		panic("sample-handler: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(versionPath, VersionHandler())
+	mux.Handle(statsPath, rsc.StatsHandler())
+	if rsc.metricsEndpoint {
+		mux.Handle(metricsPath, rsc.MetricsHandler())
+	}
+	if len(rsc.adminCredentials) > 0 {
+		mux.Handle(rateLimitResetPath, BasicAuth(adminRealm, rsc.adminCredentials)(rateLimiter.ResetHandler()))
+	}
+	mux.Handle("/", Chain(rateLimiter.Handler, gzipMW)(rsc))
+
+	rsc.requestsCounted = true
+
+	return rsc.countRequests(mux)
+}
+
+// countRequests counts every request served by a given handler as a request served by the handler.
+func (h *ResponseSizeCounter) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&h.metrics.requests, 1)
+		next.ServeHTTP(w, req)
+	})
 }
 
 // ServeHTTP receives a POST request with urls separated by a new line,
 // performs GET requests to each of that urls and returns within its response
 // a string of new-line separated byte lengths of performed requests responses.
+//
+// A request with application/json content type holds a JSON array of targets instead,
+// each of them may set a method and a body of its request, e.g.
+// [{"url": "https://example.com/graphql", "method": "POST", "body": "{\"query\": \"{ items { id } }\"}"}].
+//
+// A GET request upgrading to WebSocket sends URLs separated by a new line as its first text message
+// and receives each result as a JSON text message as soon as its URL is fetched.
+// The connection is closed once every URL is done.
+//
+// With 'sitemap' query parameter set to true submitted URLs are treated as sitemaps,
+// the URLs they list are measured instead.
+//
+// With 'source' query parameter set to true, if list sources are enabled, the request submits a single URL
+// to fetch a list of URLs separated by a new line from, the listed URLs are measured instead.
+//
+// With 'offset' and 'limit' query parameters only a page of results is measured and returned,
+// along with X-Total-Count header holding a number of results the page is taken from.
 func (h *ResponseSizeCounter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// I'd rather use github.com/gorilla/handlers and github.com/gorilla/mux
 	// to manage middleware and methods to handlers mapping,
 	// but here we go
+	if !h.requestsCounted {
+		atomic.AddInt64(&h.metrics.requests, 1)
+	}
+
+	if h.adaptive != nil {
+		defer h.adaptive.begin()()
+	}
+
+	if len(h.forwardHeaders) > 0 {
+		req = withForwardedHeader(req, h.forwardHeaders)
+	}
+
+	if h.cookieJar {
+		req = withCookieJar(req)
+	}
+
+	req, ok := h.withCABundle(req)
+	if !ok {
+		http.Error(w, fmt.Sprintf("'%s' is not a known CA bundle", req.Header.Get(caBundleHeader)), http.StatusBadRequest)
+		return
+	}
+
+	if isWebSocket(req) {
+		h.serveWebSocket(w, req)
+		return
+	}
+
 	if req.Method == http.MethodPost {
 		h.serve(w, req)
 	} else {
@@ -89,111 +452,812 @@ func (h *ResponseSizeCounter) ServeHTTP(w http.ResponseWriter, req *http.Request
 	}
 }
 func (h *ResponseSizeCounter) serve(w http.ResponseWriter, req *http.Request) {
-	if err := h.getUrls(req); err != nil {
-		http.Error(w, fmt.Errorf("get urls: %s", err).Error(), http.StatusInternalServerError)
+	p, err := parseParams(req)
+	if err != nil {
+		http.Error(w, fmt.Errorf("parse query: %s", err).Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := h.getRespSizes(); err != nil {
-		http.Error(w, fmt.Errorf("get sizes of responses: %s", err).Error(), http.StatusInternalServerError)
+	// fields selected by the request take precedence, the default ones apply only to formats supporting them
+	if len(p.fields) == 0 && len(h.fields) > 0 {
+		if f, ok := h.fields.format(p.format); ok {
+			p.fields, p.format = h.fields, f
+		}
+	}
+
+	named, ok := h.namedLists[p.list]
+	if p.list != "" && !ok {
+		http.Error(w, fmt.Sprintf("parse query: '%s' is not a known list", p.list), http.StatusBadRequest)
 		return
 	}
 
-	_, err := w.Write([]byte(h.sizes.String()))
+	targets, err := h.getTargets(req)
 	if err != nil {
+		var invalid invalidLines
+		if errors.As(err, &invalid) {
+			writeInvalidLines(w, invalid, p)
+			return
+		}
+
+		http.Error(w, fmt.Errorf("get urls: %s", err).Error(), targetsErrorStatus(err))
+		return
+	}
+
+	if p.source {
+		if targets, err = h.getSourceList(req.Context(), targets); err != nil {
+			http.Error(w, fmt.Errorf("get source list: %s", err).Error(), sourceErrorStatus(err))
+			return
+		}
+	}
+
+	if p.sitemap {
+		if targets, err = h.expandSitemaps(req.Context(), targets); err != nil {
+			http.Error(w, fmt.Errorf("expand sitemaps: %s", err).Error(), sitemapErrorStatus(err))
+			return
+		}
+	}
+
+	if len(named) > 0 {
+		targets = append(urlTargets(named), targets...)
+	}
+
+	if err := h.allowedHosts.disallowed(targets); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var exportTo string
+	if p.export != "" {
+		if exportTo, err = h.exportPath(p.export); err != nil {
+			http.Error(w, fmt.Errorf("export results: %s", err).Error(), exportErrorStatus(err))
+			return
+		}
+	}
+
+	if p.echo {
+		for _, t := range targets {
+			w.Header().Add(effectiveURLHeader, t.URL)
+		}
+	}
+
+	// URLs out of a requested page are not fetched at all
+	targets = pageTargets(w.Header(), targets, p, h.sort)
+
+	if p.format.contentType == ndjsonFormat.contentType && p.export == "" && !p.aggregate && !h.failFastOnStatus && p.slowest == 0 && p.first == 0 && h.sort == SortNone {
+		h.stream(w, req, targets, p)
+		return
+	}
+
+	var results resultSource
+	if h.spill && !h.failFastOnStatus && p.slowest == 0 && p.first == 0 && h.sort == SortNone {
+		spilled, err := h.getSpilledRespSizes(req.Context(), targets, p)
+		if err != nil {
+			http.Error(w, fmt.Errorf("get sizes of responses: %s", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		defer closeSpillFile(spilled)
+
+		results = spilled
+	} else {
+		var sizes []Result
+		if p.first > 0 {
+			sizes, err = h.getFirstRespSizes(req.Context(), targets, p)
+		} else {
+			sizes, err = h.getRespSizes(req.Context(), targets, p)
+		}
+		if err != nil {
+			http.Error(w, fmt.Errorf("get sizes of responses: %s", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if p.slowest > 0 {
+			sizes = slowestResults(sizes, p.slowest)
+		}
+
+		sortResults(sizes, h.sort)
+
+		results = resultSlice(pageResults(w.Header(), sizes, p))
+	}
+
+	fields := make(map[string]interface{})
+
+	if p.summary || p.aggregate {
+		summary, err := summarize(results)
+		if err != nil {
+			http.Error(w, fmt.Errorf("summarize sizes of responses: %s", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		summary.setHeaders(w.Header())
+		fields["summary"] = summary
+	}
+
+	if h.manifest {
+		m, err := manifest(results)
+		if err != nil {
+			http.Error(w, fmt.Errorf("compute manifest of responses: %s", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(manifestHeader, m)
+		fields["manifest"] = m
+	}
+
+	switch {
+	case p.aggregate:
+		p.format = summaryFormat(fields["summary"].(Summary))
+	case len(fields) > 0 && p.format.contentType == jsonFormat.contentType:
+		p.format = objectJSONFormat(fields, p.fields.marshal)
+	}
+
+	if exportTo != "" {
+		ref, err := export(exportTo, results)
+		if err != nil {
+			http.Error(w, fmt.Errorf("export results: %s", err).Error(), exportErrorStatus(err))
+			return
+		}
+
+		p.format = exportRefFormat(ref)
+	}
+
+	o, err := countOutcomes(results)
+	if err != nil {
+		http.Error(w, fmt.Errorf("get sizes of responses: %s", err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", p.format.contentType)
+
+	switch {
+	case o.allFailed():
+		w.WriteHeader(h.failedStatus())
+	case o.mismatched > 0 && h.mismatchStatus != 0:
+		w.WriteHeader(h.mismatchStatus)
+	}
+
+	if err := p.format.write(w, results); err != nil {
 		http.Error(w, fmt.Errorf("write response: %s", err).Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (h *ResponseSizeCounter) getUrls(req *http.Request) error {
-	bytes, err := io.ReadAll(req.Body)
+// getTargets reads targets from a request body, which is either URLs separated by a new line
+// or a JSON array of targets or a JSON object of a target template, if the request has application/json content type.
+func (h *ResponseSizeCounter) getTargets(req *http.Request) ([]target, error) {
+	body, err := h.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if isJSON(req) {
+		return decodeTargets(body)
+	}
+
+	bytes, err := io.ReadAll(body)
 	if err != nil {
-		return fmt.Errorf("read request body: %s", err)
+		return nil, fmt.Errorf("read request body: %w", err)
 	}
 
-	lines, err := splitToLines(string(bytes))
+	return h.parseTargets(string(bytes))
+}
+
+// parseTargets parses targets from URLs separated by a new line.
+func (h *ResponseSizeCounter) parseTargets(input string) ([]target, error) {
+	lines, err := splitToNumberedLines(input, h.commentPrefix, h.maxLineLength)
 	if err != nil {
-		return fmt.Errorf("split request body to lines: %s", err)
+		return nil, fmt.Errorf("split request body to lines: %w", err)
 	}
 
-	h.urls = make([]string, 0)
+	urls := make([]string, 0)
+	var invalid invalidLines
 	for _, line := range lines {
-		line := line
-		if isUrl(line) {
-			h.urls = append(h.urls, line)
+		text := line.text
+		if !h.keepSpace {
+			text = strings.TrimSpace(text)
+			if h.commentPrefix != "" && strings.HasPrefix(text, h.commentPrefix) {
+				continue
+			}
+		}
+
+		if text == "" {
+			if h.strictLines {
+				invalid = append(invalid, lineError{Line: line.number, Text: text, Error: "is blank"})
+			}
+			continue
+		}
+
+		if isUrl(text) {
+			urls = append(urls, text)
 		} else {
-			return errors.New(fmt.Sprintf("'%s' is not a URL", line))
+			invalid = append(invalid, lineError{Line: line.number, Text: text, Error: "is not a URL"})
 		}
 	}
 
-	return nil
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+
+	return urlTargets(urls), nil
 }
 
-func (h *ResponseSizeCounter) getRespSizes() error {
-	h.sizes.s = make([]int, 0)
+func (h *ResponseSizeCounter) getRespSizes(ctx context.Context, targets []target, p params) ([]Result, error) {
+	if h.failFastOnStatus {
+		return h.getRespSizesFailFast(ctx, targets, p)
+	}
 
-	// I'd rather use errgroup.Group of golang.org/x/sync/errgroup package,
-	// but here we go
-	var wg sync.WaitGroup
-	var errOnce sync.Once
-	var err error
+	sizes := newResSizes(len(targets))
+	err := h.fetchAll(ctx, targets, p, sizes.Add)
 
-	for _, url := range h.urls {
-		wg.Add(1)
+	return sizes.Results(), err
+}
 
-		url := url
-		go func(single error) {
-			defer wg.Done()
+// getFirstRespSizes returns results of the first targets to be fetched successfully, up to the number
+// 'first' query parameter requests, in order of the targets. Once there are enough of them,
+// the rest of fetches are cancelled and their results are discarded.
+//
+// Skipped and failed results are not taken into account, so fewer results are returned
+// if not enough targets are fetched successfully.
+func (h *ResponseSizeCounter) getFirstRespSizes(ctx context.Context, targets []target, p params) ([]Result, error) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	results := make([]Result, 0, p.first)
+
+	err := h.fetchAll(fetchCtx, targets, p, func(res Result) {
+		if res.Error != "" || res.Skipped != "" {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(results) == p.first {
+			return
+		}
+
+		results = append(results, res)
+		if len(results) == p.first {
+			cancel()
+		}
+	})
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].order < results[j].order
+	})
+
+	return results, nil
+}
+
+// getRespSizesFailFast fetches given targets till one of them is responded with a non-2xx status,
+// cancelling fetches of the rest. Failures to get a response don't stop fetching.
+//
+// Results of targets fetched till then, the one responded so included, are returned in the order of targets.
+func (h *ResponseSizeCounter) getRespSizesFailFast(ctx context.Context, targets []target, p params) ([]Result, error) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	stopped := false
+	results := make([]Result, 0, len(targets))
+
+	err := h.fetchAll(fetchCtx, targets, p, func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// fetches in progress are cancelled, so their results are of no use
+		if stopped {
+			return
+		}
+
+		results = append(results, res)
+		if res.Skipped == "" && res.status != 0 && (res.status < 200 || res.status > 299) {
+			stopped = true
+			cancel()
+		}
+	})
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].order < results[j].order
+	})
 
-			size, err := h.doGet(url)
+	return results, nil
+}
+
+// fetchAll fetches given targets concurrently passing their results to add.
+// A result is ordered by a position of its target, add is called once for every target.
+//
+// A failed fetch is reported by an error of its result, fetching is stopped only if ctx is done.
+func (h *ResponseSizeCounter) fetchAll(ctx context.Context, targets []target, p params, add func(res Result)) error {
+	var g errGroup
+	if h.adaptive != nil {
+		g.setLimit(h.adaptive.limit())
+	} else {
+		g.setLimit(cap(h.fetchSem))
+	}
+
+	for _, i := range h.fetchOrder(len(targets)) {
+		i, t := i, targets[i]
+		g.Go(func() error {
+			result, err := h.fetch(ctx, t, p)
 			if err != nil {
-				errOnce.Do(func() {
-					single = err
-				})
+				result.Error = err.Error()
 			}
+			result.order = i
+			add(result)
+
+			return ctx.Err()
+		})
+	}
+
+	return g.Wait()
+}
 
-			h.sizes.Add(size)
-		}(err)
+// failedStatus returns a response status used when every fetched URL fails.
+func (h *ResponseSizeCounter) failedStatus() int {
+	if h.allFailedStatus == 0 {
+		return defaultAllFailedStatus
 	}
 
-	wg.Wait()
+	return h.allFailedStatus
+}
 
-	return err
+// outcomes holds numbers of fetched URLs of a response by their outcome.
+type outcomes struct {
+	fetched    int
+	failed     int
+	mismatched int
 }
 
-func (h *ResponseSizeCounter) doGet(url string) (size int, err error) {
-	res, err := h.client.Get(url)
+// countOutcomes counts outcomes of given results. Skipped URLs are not taken into account.
+func countOutcomes(results resultSource) (o outcomes, err error) {
+	err = results.each(func(res Result) error {
+		if res.Skipped != "" {
+			return nil
+		}
+
+		o.fetched++
+		if res.Error != "" {
+			o.failed++
+		}
+		if res.Expected != nil && !res.Matched {
+			o.mismatched++
+		}
+		return nil
+	})
+
+	return o, err
+}
+
+// allFailed reports whether there is at least one fetched URL and all of them failed.
+func (o outcomes) allFailed() bool {
+	return o.fetched > 0 && o.failed == o.fetched
+}
+
+// fetch measures a given target unless it is filtered out by request parameters.
+//
+// The result is checked against a size the target expects, if any.
+func (h *ResponseSizeCounter) fetch(ctx context.Context, t target, p params) (result Result, err error) {
+	defer func() {
+		if result.Skipped == "" {
+			result.ErrorClass = classifyError(result.status, err)
+		}
+		h.metrics.observe(result, err)
+	}()
+
+	if t.Expect != nil {
+		defer func() {
+			if result.Skipped == "" {
+				result.Expected = t.Expect
+				result.Matched = err == nil && result.Size == *t.Expect
+			}
+		}()
+	}
+
+	if !p.matchesHost(t.URL) {
+		return Result{URL: t.URL, Skipped: skippedByHost}, nil
+	}
+
+	if h.fetchSem != nil {
+		select {
+		case h.fetchSem <- struct{}{}:
+			defer func() { <-h.fetchSem }()
+		case <-ctx.Done():
+			return Result{URL: t.URL}, ctx.Err()
+		}
+	}
+
+	// fetching is stopped already, e.g. failing fast, or it is stopped while the fetch waited for its turn
+	if err := ctx.Err(); err != nil {
+		return Result{URL: t.URL}, err
+	}
+
+	if h.breaker != nil {
+		host := urlHost(t.URL)
+		if !h.breaker.allow(host) {
+			return Result{URL: t.URL, Skipped: skippedByCircuit}, nil
+		}
+
+		defer func() {
+			// a fetch stopped along with the request tells nothing about the host
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+				h.breaker.release(host)
+				return
+			}
+			h.breaker.record(host, err)
+		}()
+	}
+
+	// warm-up fetches are discarded, so the measured one reflects a steady state of caches
+	for i := 0; i < h.warmUps; i++ {
+		if _, err := h.doWithTimeout(ctx, t); ctx.Err() != nil {
+			return Result{URL: t.URL}, err
+		}
+	}
+
+	return h.doWithRetries(ctx, t)
+}
+
+// doWithTimeout performs a request of a given target limited by its timeout, if any.
+func (h *ResponseSizeCounter) doWithTimeout(ctx context.Context, t target) (Result, error) {
+	if timeout := h.timeout(t); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return h.do(ctx, t)
+}
+
+// timeout returns a time limit of fetching a given target, zero if it is not limited.
+//
+// A timeout the target overrides is clamped to the maximum one.
+func (h *ResponseSizeCounter) timeout(t target) time.Duration {
+	timeout, _ := t.timeout()
+	if timeout == 0 {
+		return h.fetchTimeout
+	}
+
+	if h.maxFetchTimeout > 0 && timeout > h.maxFetchTimeout {
+		return h.maxFetchTimeout
+	}
+
+	return timeout
+}
+
+// do performs a request of a given target and measures its response.
+func (h *ResponseSizeCounter) do(ctx context.Context, t target) (result Result, err error) {
+	result.URL = t.URL
+
+	var wf *waterfall
+	if h.timings {
+		wf = &waterfall{}
+	}
+
+	start := time.Now()
+	defer func() {
+		result.Latency = time.Since(start)
+		if wf != nil {
+			result.Timings = wf.timings()
+		}
+	}()
+
+	redirected := 0
+	if h.redirectSizeMode == RedirectSizeSum {
+		ctx = withRedirectSize(ctx, &redirected)
+	}
+
+	if h.schemeDowngradeMode == SchemeDowngradeFlag {
+		ctx = withSchemeDowngrade(ctx, &result.SchemeDowngrade)
+	}
+
+	res, err := h.send(ctx, t, start, wf, &result)
 	if err != nil {
-		return 0, fmt.Errorf("GET '%s': %s", url, err)
+		return result, fmt.Errorf("%s '%s': %w", t.method(), t.URL, err)
 	}
 	defer closeResBody(res.Body)
 
-	bytes, err := io.ReadAll(res.Body)
+	result.status = res.StatusCode
+	result.Proto = res.Proto
+
+	for _, hook := range h.responseHooks {
+		hook(res)
+	}
+
+	if !h.countsContentType(res.Header.Get("Content-Type")) {
+		result.Skipped = skippedByType
+		return result, nil
+	}
+
+	if h.maxContentLength > 0 && res.ContentLength > h.maxContentLength {
+		return result, fmt.Errorf("content length %d exceeds %d bytes", res.ContentLength, h.maxContentLength)
+	}
+
+	// the body is not downloaded, closing it drops the connection instead of draining it
+	if h.sizeGate > 0 && res.ContentLength > h.sizeGate {
+		result.Skipped = skippedBySize
+		result.AdvertisedSize = res.ContentLength
+		return result, nil
+	}
+
+	var body io.Reader = res.Body
+	if h.maxBodySize > 0 {
+		body = io.LimitReader(body, h.maxBodySize)
+	}
+
+	var bodyHash hash.Hash
+	if h.hashBodies {
+		bodyHash = sha256.New()
+		body = io.TeeReader(body, bodyHash)
+	}
+
+	// the body is counted as it streams by, so memory used doesn't depend on its size;
+	// it is read till EOF regardless of Content-Length, which HTTP/1.0 responses often lack
+	n, err := io.Copy(io.Discard, body)
+
+	// the default transport reports a body shorter than its Content-Length as an unexpected EOF,
+	// other clients may deliver a body of any length as is
+	received := err == nil || errors.Is(err, io.ErrUnexpectedEOF)
+
+	if err == nil && h.maxBodySize > 0 && n == h.maxBodySize {
+		// the limit is reached, a byte beyond it means the body is truncated
+		if n, _ := io.ReadFull(res.Body, make([]byte, 1)); n > 0 {
+			result.Truncated = true
+			if res.ContentLength > 0 {
+				result.AdvertisedSize = res.ContentLength
+			}
+		}
+	}
+
+	// a response to HEAD request declares a length of a body it doesn't have
+	declared := res.ContentLength >= 0 && res.Header.Get("Content-Length") != "" && t.method() != http.MethodHead
+	if received && declared && !result.Truncated && res.ContentLength != n {
+		result.LengthMismatch = true
+		result.AdvertisedSize = res.ContentLength
+		result.ReceivedSize = n
+	}
+
+	// a partially read body doesn't make a size, bytes read before the failure are reported on their own
 	if err != nil {
-		err = fmt.Errorf("read response body: %s", err)
+		result.ReadError = true
+		result.PartialSize = n
+		return result, fmt.Errorf("read response body: %w", err)
+	}
+
+	result.Size = redirected + int(n)
+	if bodyHash != nil {
+		result.Hash = hex.EncodeToString(bodyHash.Sum(nil))
+	}
+
+	return result, nil
+}
+
+// countsContentType reports whether a response of a given content type is counted.
+func (h *ResponseSizeCounter) countsContentType(contentType string) bool {
+	if len(h.contentTypes) == 0 {
+		return true
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range h.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
 	}
 
-	return len(bytes), err
+	return false
 }
 
-func splitToLines(input string) (lines []string, err error) {
-	lines = make([]string, 0)
+// send performs a request of a given target.
+//
+// A time to the first response byte since start is stored to the result TTFB. It is measured
+// till the first byte of the first response, so a reused connection and redirects don't affect it.
+// The request is described by the result Request, if recording is enabled,
+// and its phases are measured by a given waterfall, if any.
+func (h *ResponseSizeCounter) send(ctx context.Context, t target, start time.Time, wf *waterfall, result *Result) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			if result.TTFB == 0 {
+				result.TTFB = time.Since(start)
+			}
+		},
+	}
+
+	if h.traceConnections {
+		result.ConnectionCounts = &ConnectionCounts{}
+		trace.GotConn = func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				result.Reused++
+			} else {
+				result.New++
+			}
+		}
+	}
+
+	var dns *phaseTimer
+	if wf != nil {
+		dns = &wf.dns
+		wf.trace(trace)
+	} else if h.timeDNS {
+		dns = &phaseTimer{}
+	}
+	if dns != nil {
+		traceDNS(trace, dns)
+	}
+
+	req, err := t.newRequest(httptrace.WithClientTrace(ctx, trace))
+	if err != nil {
+		return nil, err
+	}
+
+	forwardHeader(ctx, req)
+	addCookies(ctx, req)
+
+	if h.accept != "" {
+		req.Header.Set("Accept", h.accept)
+	}
+
+	for _, hook := range h.requestHooks {
+		hook(req)
+	}
+
+	if h.recordRequests {
+		result.Request = recordRequest(req)
+	}
+
+	res, err := h.getter().Do(req)
+	if err == nil {
+		storeCookies(ctx, req, res)
+	}
+
+	if h.timeDNS {
+		result.DNS = dns.total()
+	}
+
+	return res, err
+}
+
+// SetClient replaces a client performing outbound requests.
+//
+// It is safe to call SetClient concurrently with serving requests:
+// the new client performs every outbound request sent after SetClient returns,
+// while requests already sent by the previous client are completed by it.
+// Options configuring the default transport have no effect on the new client.
+func (h *ResponseSizeCounter) SetClient(client Getter) {
+	h.clientMu.Lock()
+	defer h.clientMu.Unlock()
+
+	h.client = client
+}
+
+// getter returns a client performing outbound requests.
+func (h *ResponseSizeCounter) getter() Getter {
+	h.clientMu.RLock()
+	defer h.clientMu.RUnlock()
+
+	return h.client
+}
+
+// slowestResults returns up to n results having the highest latency, the slowest one first.
+func slowestResults(results []Result, n int) []Result {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Latency > results[j].Latency
+	})
+
+	if n < len(results) {
+		results = results[:n]
+	}
+
+	return results
+}
+
+// SortOrder defines an order of results within a response.
+type SortOrder int
+
+const (
+	// SortNone keeps results in the order their URLs are fetched in.
+	SortNone SortOrder = iota
+	// SortByURL sorts results lexicographically by URL, duplicate URLs keep the order of the request.
+	SortByURL
+)
+
+// sortResults sorts results in a given order.
+func sortResults(results []Result, order SortOrder) {
+	if order == SortByURL {
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].URL != results[j].URL {
+				return results[i].URL < results[j].URL
+			}
+			return results[i].order < results[j].order
+		})
+	}
+}
+
+// bodyLine is a line of a request body along with its 1-based number.
+type bodyLine struct {
+	number int
+	text   string
+}
+
+// defaultMaxLineLength is a maximum length of a line of a request body in bytes, unless it is configured.
+const defaultMaxLineLength = bufio.MaxScanTokenSize
+
+// errLineTooLong fails requests having a line longer than the maximum length.
+var errLineTooLong = errors.New("line is too long")
+
+// splitToLines splits input to lines skipping blank ones.
+// Lines starting with a comment prefix are skipped as well, unless the prefix is empty.
+func splitToLines(input string, commentPrefix string) (lines []string, err error) {
+	numbered, err := splitToNumberedLines(input, commentPrefix, defaultMaxLineLength)
+
+	lines = make([]string, 0, len(numbered))
+	for _, line := range numbered {
+		if line.text != "" {
+			lines = append(lines, line.text)
+		}
+	}
+
+	return lines, err
+}
+
+// splitToNumberedLines splits input to lines keeping their numbers.
+// Lines starting with a comment prefix are skipped, unless the prefix is empty, while blank ones are kept.
+//
+// It fails with errLineTooLong if a line is longer than maxLine bytes, or than the default maximum if maxLine is not positive.
+func splitToNumberedLines(input string, commentPrefix string, maxLine int) (lines []bodyLine, err error) {
+	if maxLine <= 0 {
+		maxLine = defaultMaxLineLength
+	}
+
+	lines = make([]bodyLine, 0)
 	sc := bufio.NewScanner(strings.NewReader(input))
+	// the buffer holds a line along with its new line character, it never grows beyond the larger of max and its capacity
+	size := 4096
+	if maxLine < size {
+		size = maxLine + 1
+	}
+	sc.Buffer(make([]byte, 0, size), maxLine+1)
 
-	for sc.Scan() {
+	number := 1
+	for ; sc.Scan(); number++ {
 		line := sc.Text()
-		if line != "" {
-			lines = append(lines, line)
+		if commentPrefix != "" && strings.HasPrefix(line, commentPrefix) {
+			continue
 		}
+
+		lines = append(lines, bodyLine{number: number, text: line})
+	}
+
+	if errors.Is(sc.Err(), bufio.ErrTooLong) {
+		return lines, fmt.Errorf("line %d is longer than %d bytes: %w", number, maxLine, errLineTooLong)
 	}
 
 	return lines, sc.Err()
 }
 
+// isUrl reports whether a given string is an absolute URL, whitespaces are not allowed within it.
+// A file URL has a path instead of a host.
 func isUrl(str string) bool {
+	if strings.IndexFunc(str, unicode.IsSpace) >= 0 {
+		return false
+	}
+
 	u, err := net_url.Parse(str)
-	return err == nil && u.Scheme != "" && u.Host != ""
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+
+	if u.Scheme == fileScheme {
+		return u.Host == "" && u.Path != ""
+	}
+
+	return u.Host != ""
 }
 
 func closeResBody(body io.ReadCloser) {
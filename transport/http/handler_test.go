@@ -1,12 +1,23 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	net_url "net/url"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
@@ -15,6 +26,19 @@ import (
 
 //go:generate mockgen -destination mock/client_mock.go -package http_mock -mock_names Getter=MockClient github.com/laonix/sample-handler/transport/http Getter
 
+// newResponseSizeCounter returns a new instance of ResponseSizeCounter configured with given options,
+// failing a test if they are invalid.
+func newResponseSizeCounter(tb testing.TB, opts ...Option) *ResponseSizeCounter {
+	tb.Helper()
+
+	h, err := NewResponseSizeCounter(opts...)
+	if err != nil {
+		tb.Fatalf("new response size counter: %v", err)
+	}
+
+	return h
+}
+
 func TestResponseSizeCounter_ServeHTTP_happyPath(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -23,14 +47,13 @@ func TestResponseSizeCounter_ServeHTTP_happyPath(t *testing.T) {
 	{
 		calls := make([]*gomock.Call, 0)
 		for i := 0; i < 3; i++ {
-			calls = append(calls, client.EXPECT().Get(gomock.Any()).Return(response(http.StatusOK), nil))
+			calls = append(calls, client.EXPECT().Do(gomock.Any()).Return(response(http.StatusOK), nil))
 		}
 		gomock.InOrder(calls...)
 	}
 
 	handler := &ResponseSizeCounter{
 		client: client,
-		sizes:  resSizes{},
 	}
 
 	w := httptest.NewRecorder()
@@ -48,7 +71,7 @@ func TestResponseSizeCounter_ServeHTTP_happyPath(t *testing.T) {
 		t.Errorf("cannot read response body: %s", err)
 	}
 
-	resLines, err := splitToLines(string(body))
+	resLines, err := splitToLines(string(body), "")
 	if err != nil {
 		t.Errorf("cannot split response body to lines: %s", err)
 	}
@@ -72,7 +95,6 @@ func TestResponseSizeCounter_ServeHTTP_wrongMethod(t *testing.T) {
 
 	handler := &ResponseSizeCounter{
 		client: client,
-		sizes:  resSizes{},
 	}
 
 	w := httptest.NewRecorder()
@@ -94,7 +116,6 @@ func TestResponseSizeCounter_ServeHTTP_wrongInput(t *testing.T) {
 
 	handler := &ResponseSizeCounter{
 		client: client,
-		sizes:  resSizes{},
 	}
 
 	w := httptest.NewRecorder()
@@ -102,12 +123,413 @@ func TestResponseSizeCounter_ServeHTTP_wrongInput(t *testing.T) {
 	handler.ServeHTTP(w, badRequest())
 
 	res := w.Result()
-	if res.StatusCode != http.StatusInternalServerError {
+	if res.StatusCode != http.StatusBadRequest {
 		t.Error("wrong request body method handled incorrectly")
 	}
 	defer closeResBody(res.Body)
 }
 
+func TestResponseSizeCounter_ServeHTTP_slowest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	delays := map[string]time.Duration{
+		"https://test-1.com": 100 * time.Millisecond,
+		"http://test-2.com":  0,
+		"https://test-3.com": 50 * time.Millisecond,
+	}
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			time.Sleep(delays[req.URL.String()])
+			return response(http.StatusOK), nil
+		}).Times(3)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := request()
+	req.URL = &net_url.URL{RawQuery: "slowest=2"}
+	req.Header = http.Header{"Accept": []string{"application/json"}}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	var results []Result
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	want := []string{"https://test-1.com", "https://test-3.com"}
+	if len(results) != len(want) {
+		t.Fatalf("results count: want = %d, got = %d", len(want), len(results))
+	}
+
+	for i, url := range want {
+		if results[i].URL != url {
+			t.Errorf("wrong slow result #%d: want = %s, got = %s", i, url, results[i].URL)
+		}
+		if results[i].Latency < delays[url] {
+			t.Errorf("wrong latency of %s: want >= %s, got = %s", url, delays[url], results[i].Latency)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_first(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	delays := map[string]time.Duration{
+		"https://test-1.com": 10 * time.Second,
+		"https://test-2.com": 20 * time.Millisecond,
+		"https://test-3.com": 0,
+		"https://test-4.com": 10 * time.Second,
+		"https://test-5.com": 10 * time.Millisecond,
+	}
+
+	var cancelled int32
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			if req.URL.String() == "https://test-3.com" {
+				return nil, errors.New("connection refused")
+			}
+
+			select {
+			case <-time.After(delays[req.URL.String()]):
+				return response(http.StatusOK), nil
+			case <-req.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return nil, req.Context().Err()
+			}
+		}).Times(5)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "first=2"},
+		Header: http.Header{"Accept": []string{"application/json"}},
+		Body:   io.NopCloser(strings.NewReader(strings.Join([]string{"https://test-1.com", "https://test-2.com", "https://test-3.com", "https://test-4.com", "https://test-5.com"}, "\n"))),
+	}
+
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("slow fetches are not cancelled: elapsed = %s", elapsed)
+	}
+
+	if got := atomic.LoadInt32(&cancelled); got != 2 {
+		t.Errorf("wrong number of cancelled fetches: want = %d, got = %d", 2, got)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	want := []string{"https://test-2.com", "https://test-5.com"}
+	if len(results) != len(want) {
+		t.Fatalf("results count: want = %d, got = %d", len(want), len(results))
+	}
+
+	for i, url := range want {
+		if results[i].URL != url || results[i].Error != "" {
+			t.Errorf("wrong first result #%d: want = %s, got = %+v", i, url, results[i])
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongSlowest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := &ResponseSizeCounter{
+		client: http_mock.NewMockClient(ctrl),
+	}
+
+	req := request()
+	req.URL = &net_url.URL{RawQuery: "slowest=-1"}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusBadRequest, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+}
+
+func TestResponseSizeCounter_ServeHTTP_echo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+			return response(http.StatusOK), nil
+		}).Times(3)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	body := `https://Test-1.com
+https://test-1.com
+
+https://Test-1.com`
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "echo=true"},
+		Body:   io.NopCloser(bytes.NewBufferString(body)),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	want := []string{"https://Test-1.com", "https://test-1.com", "https://Test-1.com"}
+	got := res.Header.Values(effectiveURLHeader)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("wrong effective urls: want = %v, got = %v", want, got)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_failedStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		failing int
+		want    int
+	}{
+		{name: "all succeed", failing: 0, want: http.StatusOK},
+		{name: "mixed", failing: 2, want: http.StatusOK},
+		{name: "all fail", failing: 3, want: http.StatusBadGateway},
+		{name: "all fail, custom status", status: http.StatusServiceUnavailable, failing: 3, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			{
+				urls := []string{"https://test-1.com", "http://test-2.com", "https://test-3.com"}
+				for i, url := range urls {
+					if i < tt.failing {
+						client.EXPECT().Do(requestTo(url)).Return(nil, errors.New("connection refused"))
+					} else {
+						client.EXPECT().Do(requestTo(url)).Return(response(http.StatusOK), nil)
+					}
+				}
+			}
+
+			handler := &ResponseSizeCounter{
+				client:          client,
+				allFailedStatus: tt.status,
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, request())
+
+			res := w.Result()
+			defer closeResBody(res.Body)
+
+			if res.StatusCode != tt.want {
+				t.Errorf("wrong response status: want = %d, got = %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_SetClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	first := http_mock.NewMockClient(ctrl)
+	first.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		return response(http.StatusOK), nil
+	}).Times(3)
+
+	second := http_mock.NewMockClient(ctrl)
+	second.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		return response(http.StatusOK), nil
+	}).Times(3)
+
+	handler := &ResponseSizeCounter{
+		client: first,
+	}
+
+	for _, client := range []Getter{first, second} {
+		handler.SetClient(client)
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, request())
+
+		if w.Code != http.StatusOK {
+			t.Errorf("wrong response status: want = %d, got = %d", http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestResponseSizeCounter_getRespSizes_cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inFlight := make(chan struct{})
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-0.com")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			close(inFlight)
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+		client.EXPECT().Do(requestTo("https://test-1.com")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			<-inFlight
+			cancel()
+			return nil, errors.New("connection refused")
+		})
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	targets := urlTargets([]string{"https://test-0.com", "https://test-1.com"})
+
+	done := make(chan error)
+	go func() {
+		_, err := handler.getRespSizes(ctx, targets, params{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("wrong error: want = %v, got = %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight fetch was not cancelled")
+	}
+}
+
+func TestResponseSizeCounter_do_ttfb(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		time.Sleep(delay)
+		_, _ = w.Write([]byte(strings.Repeat("0", 25*1000)))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t)
+
+	for i := 0; i < 2; i++ {
+		result, err := handler.do(context.Background(), target{URL: srv.URL})
+		if err != nil {
+			t.Fatalf("cannot get response: %s", err)
+		}
+
+		if result.TTFB < delay || result.TTFB >= result.Latency {
+			t.Errorf("wrong TTFB: want in [%s, %s), got = %s", delay, result.Latency, result.TTFB)
+		}
+
+		if result.Latency < 2*delay {
+			t.Errorf("wrong latency: want >= %s, got = %s", 2*delay, result.Latency)
+		}
+	}
+}
+
+func TestSplitToLines(t *testing.T) {
+	input := `https://test-1.com
+
+# staging
+https://test-2.com
+#https://test-3.com
+	`
+
+	tests := []struct {
+		name          string
+		commentPrefix string
+		want          []string
+	}{
+		{
+			name:          "comments disabled",
+			commentPrefix: "",
+			want:          []string{"https://test-1.com", "# staging", "https://test-2.com", "#https://test-3.com", "\t"},
+		},
+		{
+			name:          "comments enabled",
+			commentPrefix: "#",
+			want:          []string{"https://test-1.com", "https://test-2.com", "\t"},
+		},
+	}
+
+	for _, tt := range tests {
+		lines, err := splitToLines(input, tt.commentPrefix)
+		if err != nil {
+			t.Fatalf("%s: cannot split to lines: %s", tt.name, err)
+		}
+
+		if strings.Join(lines, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: wrong lines: want = %q, got = %q", tt.name, tt.want, lines)
+		}
+	}
+}
+
+// requestTo matches outbound requests to a given URL.
+func requestTo(url string) gomock.Matcher {
+	return urlMatcher(url)
+}
+
+type urlMatcher string
+
+func (m urlMatcher) Matches(x interface{}) bool {
+	req, ok := x.(*http.Request)
+	return ok && req.URL.String() == string(m)
+}
+
+func (m urlMatcher) String() string {
+	return "is a request to " + string(m)
+}
+
 func request() *http.Request {
 	body := `https://test-1.com
 http://test-2.com
@@ -136,3 +558,323 @@ func response(status int) *http.Response {
 		Body:       io.NopCloser(strings.NewReader(strings.Repeat("0", 25*1000))), // body of size 25 kb
 	}
 }
+
+func TestResponseSizeCounter_ServeHTTP_longLine(t *testing.T) {
+	longURL := func(n int) string {
+		return "https://test-1.com/?q=" + strings.Repeat("0", n-len("https://test-1.com/?q="))
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		line   string
+		status int
+	}{
+		{name: "long", line: longURL(60 << 10), status: http.StatusOK},
+		{name: "default maximum", line: longURL(defaultMaxLineLength), status: http.StatusOK},
+		{name: "over default maximum", line: longURL(defaultMaxLineLength + 1), status: http.StatusBadRequest},
+		{name: "configured maximum", opts: []Option{WithMaxLineLength(1 << 20)}, line: longURL(1 << 20), status: http.StatusOK},
+		{name: "over configured maximum", opts: []Option{WithMaxLineLength(100)}, line: longURL(101), status: http.StatusBadRequest},
+		{name: "no new line", opts: []Option{WithMaxLineLength(100)}, line: strings.Repeat("0", 1<<20), status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newResponseSizeCounter(t, tt.opts...)
+			handler.SetClient(StaticGetter{Size: 1})
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &net_url.URL{},
+				Body:   io.NopCloser(strings.NewReader("https://test-0.com\n" + tt.line + "\nhttps://test-2.com\n")),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("wrong status: want = %d, got = %d", tt.status, w.Code)
+			}
+
+			if tt.status == http.StatusBadRequest && !strings.Contains(w.Body.String(), "line 2 is longer than") {
+				t.Errorf("error doesn't name the line: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_do_http10(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// an HTTP/1.0 response without Content-Length ends with the connection
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		ProtoMinor:    0,
+		ContentLength: -1,
+		Close:         true,
+		Body:          io.NopCloser(strings.NewReader(strings.Repeat("0", 1000))),
+	}, nil)
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	result, err := handler.do(context.Background(), target{URL: "https://legacy.com"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if result.Size != 1000 || result.Proto != "HTTP/1.0" {
+		t.Errorf("wrong result of HTTP/1.0 response: %+v", result)
+	}
+}
+
+func TestResponseSizeCounter_do_http10Server(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = http.ReadRequest(bufio.NewReader(conn))
+		_, _ = io.WriteString(conn, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\n"+strings.Repeat("0", 1000))
+	}()
+
+	result, err := newResponseSizeCounter(t).do(context.Background(), target{URL: "http://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if result.Size != 1000 || result.Proto != "HTTP/1.0" {
+		t.Errorf("wrong result of HTTP/1.0 response: %+v", result)
+	}
+}
+
+func TestResponseSizeCounter_do_lengthMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		declared string
+		body     string
+		want     bool
+	}{
+		{name: "longer", declared: "5", body: "hello, world", want: true},
+		{name: "shorter", declared: "100", body: "hello, world", want: true},
+		{name: "matching", declared: "12", body: "hello, world"},
+		{name: "unknown", body: "hello, world"},
+		{name: "head", method: http.MethodHead, declared: "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			res := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{},
+				ContentLength: -1,
+				Body:          io.NopCloser(strings.NewReader(tt.body)),
+			}
+			if tt.declared != "" {
+				res.Header.Set("Content-Length", tt.declared)
+				res.ContentLength, _ = strconv.ParseInt(tt.declared, 10, 64)
+			}
+
+			client := http_mock.NewMockClient(ctrl)
+			client.EXPECT().Do(gomock.Any()).Return(res, nil)
+
+			handler := &ResponseSizeCounter{
+				client: client,
+			}
+
+			result, err := handler.do(context.Background(), target{URL: "https://test-1.com", Method: tt.method})
+			if err != nil {
+				t.Fatalf("cannot get response: %s", err)
+			}
+
+			if result.LengthMismatch != tt.want {
+				t.Fatalf("wrong length mismatch: want = %t, got = %t", tt.want, result.LengthMismatch)
+			}
+
+			if tt.want && (result.AdvertisedSize != res.ContentLength || result.ReceivedSize != int64(len(tt.body))) {
+				t.Errorf("wrong lengths: want = %d declared and %d received, got = %d and %d",
+					res.ContentLength, len(tt.body), result.AdvertisedSize, result.ReceivedSize)
+			}
+		})
+	}
+}
+
+// failingReader reads n zero bytes and fails with err then.
+type failingReader struct {
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, r.err
+	}
+
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.n -= len(p)
+
+	return len(p), nil
+}
+
+func TestResponseSizeCounter_do_readError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reset := errors.New("connection reset by peer")
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: -1,
+		Body:          io.NopCloser(&failingReader{n: 1000, err: reset}),
+	}, nil)
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	result, err := handler.do(context.Background(), target{URL: "https://test-1.com"})
+	if !errors.Is(err, reset) {
+		t.Fatalf("wrong error: want = %v, got = %v", reset, err)
+	}
+
+	if !result.ReadError || result.PartialSize != 1000 || result.Size != 0 {
+		t.Errorf("wrong result of a failed read: want = read error of %d bytes, got = %+v", 1000, result)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("cannot encode result: %s", err)
+	}
+	if !strings.Contains(string(encoded), `"read_error":true,"partial_size":1000`) {
+		t.Errorf("read error is not rendered: %s", encoded)
+	}
+}
+
+func BenchmarkResponseSizeCounter_getRespSizes(b *testing.B) {
+	handler := &ResponseSizeCounter{
+		client: StaticGetter{Size: 1},
+	}
+
+	urls := make([]string, 1000)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://test-%d.com", i)
+	}
+	targets := urlTargets(urls)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := handler.getRespSizes(context.Background(), targets, params{}); err != nil {
+			b.Fatalf("cannot get sizes: %s", err)
+		}
+	}
+}
+
+func BenchmarkResponseSizeCounter_serve(b *testing.B) {
+	handler := newResponseSizeCounter(b)
+	handler.SetClient(StaticGetter{Size: 1024})
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		req := LoadTestRequest(10000, "format=json")
+		w := httptest.NewRecorder()
+		b.StartTimer()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			b.Fatalf("wrong status: want = %d, got = %d", http.StatusOK, w.Code)
+		}
+	}
+}
+
+// getterFunc is a Getter calling itself.
+type getterFunc func(req *http.Request) (*http.Response, error)
+
+func (f getterFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func hugeResponse(size int64) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(io.LimitReader(zeroReader{}, size)),
+	}
+}
+
+func TestResponseSizeCounter_do_boundedMemory(t *testing.T) {
+	const size = 64 << 20
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(hugeResponse(size), nil)
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	result, err := handler.do(context.Background(), target{URL: "https://huge.com"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if result.Size != size {
+		t.Errorf("wrong response size: want = %d, got = %d", size, result.Size)
+	}
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("counting a body of %d bytes allocated %d bytes", size, allocated)
+	}
+}
+
+func BenchmarkResponseSizeCounter_do_hugeBody(b *testing.B) {
+	handler := &ResponseSizeCounter{
+		client: getterFunc(func(*http.Request) (*http.Response, error) {
+			return hugeResponse(64 << 20), nil
+		}),
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(64 << 20)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := handler.do(context.Background(), target{URL: "https://huge.com"}); err != nil {
+			b.Fatalf("cannot get response: %s", err)
+		}
+	}
+}
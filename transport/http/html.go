@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+)
+
+// htmlFormat renders results as an HTML page with a table sortable by clicking its headers.
+var htmlFormat = format{contentType: "text/html; charset=utf-8", write: writeHTML}
+
+// htmlHead opens a page and its table of results.
+//
+// Cells of numeric columns hold raw values in data-value attributes, so they are sorted numerically.
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Response sizes</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+th { cursor: pointer; background: #eee; }
+td.number { text-align: right; }
+</style>
+</head>
+<body>
+<table id="results">
+<thead><tr><th>URL</th><th>Size</th><th>Status</th><th>Latency</th></tr></thead>
+<tbody>
+`
+
+// htmlTail closes the table and its page along with a script sorting the table.
+const htmlTail = `</tbody>
+</table>
+<script>
+document.querySelectorAll("#results th").forEach(function (th, column) {
+  var ascending = false;
+  th.addEventListener("click", function () {
+    ascending = !ascending;
+    var tbody = document.querySelector("#results tbody");
+    var value = function (row) {
+      var cell = row.cells[column];
+      return cell.hasAttribute("data-value") ? Number(cell.getAttribute("data-value")) : cell.textContent;
+    };
+    Array.from(tbody.rows).sort(function (a, b) {
+      var x = value(a), y = value(b);
+      return (x < y ? -1 : x > y ? 1 : 0) * (ascending ? 1 : -1);
+    }).forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`
+
+// writeHTML writes results as rows of an HTML table, the table is written even if there are no results.
+//
+// Every value is escaped, so URLs are not able to inject markup into the page.
+// A status cell of a result without a response holds its error or the reason it is skipped.
+func writeHTML(w io.Writer, results resultSource) error {
+	if _, err := io.WriteString(w, htmlHead); err != nil {
+		return err
+	}
+
+	err := results.each(func(res Result) error {
+		status := ""
+		switch {
+		case res.status != 0:
+			status = strconv.Itoa(res.status)
+		case res.Error != "":
+			status = res.Error
+		case res.Skipped != "":
+			status = "skipped: " + res.Skipped
+		}
+
+		_, err := fmt.Fprintf(w,
+			"<tr><td>%s</td><td class=\"number\" data-value=\"%d\">%s</td><td>%s</td><td class=\"number\" data-value=\"%d\">%s</td></tr>\n",
+			html.EscapeString(res.URL), res.Size, html.EscapeString(humanSize(res.Size)),
+			html.EscapeString(status), int64(res.Latency), html.EscapeString(res.Latency.String()))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, htmlTail)
+	return err
+}
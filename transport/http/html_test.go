@@ -0,0 +1,52 @@
+package http
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_writeHTML(t *testing.T) {
+	results := []Result{
+		{URL: "https://example.com", Size: 25000, Latency: 120 * time.Millisecond, status: 200},
+		{URL: "https://fail.com", Error: "connection refused"},
+		{URL: `https://evil.com/"><script>alert(1)</script>`, Size: 4, status: 404},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHTML(&buf, resultSlice(results)); err != nil {
+		t.Fatalf("cannot write results: %s", err)
+	}
+	page := buf.String()
+
+	rows := []string{
+		`<tr><td>https://example.com</td><td class="number" data-value="25000">24.4 KiB</td><td>200</td>` +
+			`<td class="number" data-value="120000000">120ms</td></tr>`,
+		`<tr><td>https://fail.com</td><td class="number" data-value="0">0 B</td><td>connection refused</td>`,
+		`<tr><td>https://evil.com/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</td>`,
+	}
+	for _, row := range rows {
+		if !strings.Contains(page, row) {
+			t.Errorf("row is missing: want = %q, got = %q", row, page)
+		}
+	}
+
+	if strings.Contains(page, "<script>alert") {
+		t.Errorf("URL is not escaped: %q", page)
+	}
+	if !strings.HasPrefix(page, "<!DOCTYPE html>") || !strings.HasSuffix(page, "</html>\n") {
+		t.Errorf("page is not complete: %q", page)
+	}
+}
+
+func Test_writeHTML_noResults(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHTML(&buf, resultSlice(nil)); err != nil {
+		t.Fatalf("cannot write results: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "<tbody>\n</tbody>") {
+		t.Errorf("wrong empty table: %q", buf.String())
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	net_url "net/url"
+	"strings"
+)
+
+// StaticGetter is a Getter responding to every request at once with a body of Size zero bytes, never touching a network.
+//
+// Set with SetClient, it makes a throughput of the handler itself measurable, e.g. in benchmarks and load tests.
+type StaticGetter struct {
+	Size int64
+}
+
+// Do responds to a given request with a body of the static size.
+func (g StaticGetter) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: -1,
+		Body:          io.NopCloser(io.LimitReader(zeroReader{}, g.Size)),
+		Request:       req,
+	}, nil
+}
+
+// LoadTestRequest returns a new POST request of n distinct URLs separated by a new line,
+// along with given query parameters, e.g. "format=json", to be served by the handler.
+func LoadTestRequest(n int, query string) *http.Request {
+	var body strings.Builder
+	for i := 0; i < n; i++ {
+		_, _ = fmt.Fprintf(&body, "https://load-%d.test/\n", i)
+	}
+
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{Path: "/", RawQuery: query},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body.String())),
+	}
+}
+
+// zeroReader is an endless reader of zero bytes, so a body of any size is never held in memory.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadTestRequest(t *testing.T) {
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(StaticGetter{Size: 100})
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, LoadTestRequest(50, "format=json"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status: want = %d, got = %d", http.StatusOK, w.Code)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 50 {
+		t.Fatalf("wrong number of results: want = %d, got = %d", 50, len(results))
+	}
+
+	seen := make(map[string]bool)
+	for _, res := range results {
+		if res.Size != 100 || res.Error != "" {
+			t.Errorf("wrong result: %+v", res)
+		}
+		seen[res.URL] = true
+	}
+
+	if len(seen) != 50 {
+		t.Errorf("URLs are not distinct: %d of %d", len(seen), 50)
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUStatHolder is an implementation of Stat tracking a bounded number of IPs.
+//
+// When the bound is reached, a counter of the least recently incremented IP is evicted
+// to track a new one, so memory stays bounded even under a flood of spoofed source IPs.
+// An evicted IP counts from zero when it comes back, so the bound should be well above
+// a number of distinct clients expected within a window.
+type LRUStatHolder struct {
+	mu   sync.Mutex
+	size int
+	// order holds counters from the most recently to the least recently incremented one.
+	order    *list.List
+	counters map[string]*list.Element
+}
+
+// lruCounter is a counter of requests from an IP held by LRUStatHolder.
+type lruCounter struct {
+	id    string
+	count int32
+}
+
+// NewLRUStatHolder returns a new instance of LRUStatHolder tracking up to size IPs, at least one.
+func NewLRUStatHolder(size int) *LRUStatHolder {
+	if size < 1 {
+		size = 1
+	}
+
+	return &LRUStatHolder{
+		size:     size,
+		order:    list.New(),
+		counters: make(map[string]*list.Element, size),
+	}
+}
+
+// Reset clears counters of all IPs.
+func (sh *LRUStatHolder) Reset() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.order.Init()
+	sh.counters = make(map[string]*list.Element, sh.size)
+}
+
+// Increment adds 1 to a counter of requests incoming from a given IP,
+// evicting the least recently incremented counter if there are too many of them.
+func (sh *LRUStatHolder) Increment(id string) int32 {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if el, ok := sh.counters[id]; ok {
+		sh.order.MoveToFront(el)
+		c := el.Value.(*lruCounter)
+		c.count++
+		return c.count
+	}
+
+	if sh.order.Len() >= sh.size {
+		oldest := sh.order.Back()
+		sh.order.Remove(oldest)
+		delete(sh.counters, oldest.Value.(*lruCounter).id)
+	}
+
+	sh.counters[id] = sh.order.PushFront(&lruCounter{id: id, count: 1})
+
+	return 1
+}
+
+// Peek returns a counter of requests incoming from a given IP.
+// It doesn't make the counter recently used.
+func (sh *LRUStatHolder) Peek(id string) int32 {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if el, ok := sh.counters[id]; ok {
+		return el.Value.(*lruCounter).count
+	}
+
+	return 0
+}
+
+// Len returns a number of tracked IPs.
+func (sh *LRUStatHolder) Len() int {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.order.Len()
+}
+
+// Close does nothing as LRUStatHolder holds no resources to release.
+func (sh *LRUStatHolder) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var _ Stat = (*LRUStatHolder)(nil)
+
+func TestLRUStatHolder_eviction(t *testing.T) {
+	sh := NewLRUStatHolder(2)
+
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.2")
+
+	// 127.0.0.1 becomes the most recently used, so 127.0.0.2 is evicted next
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.3")
+
+	if got := sh.Len(); got != 2 {
+		t.Errorf("wrong number of tracked IPs: want = %d, got = %d", 2, got)
+	}
+	if got := sh.Peek("127.0.0.1"); got != 3 {
+		t.Errorf("recently used counter is evicted: want = %d, got = %d", 3, got)
+	}
+	if got := sh.Peek("127.0.0.2"); got != 0 {
+		t.Errorf("least recently used counter is not evicted: want = %d, got = %d", 0, got)
+	}
+	if got := sh.Increment("127.0.0.2"); got != 1 {
+		t.Errorf("evicted counter does not count from zero: want = %d, got = %d", 1, got)
+	}
+}
+
+func TestLRUStatHolder_manyKeys(t *testing.T) {
+	const size = 100
+
+	sh := NewLRUStatHolder(size)
+
+	// a client making requests along with a spray of unique IPs stays tracked
+	for i := 0; i < 100*size; i++ {
+		sh.Increment("10.0.0.1")
+		sh.Increment(fmt.Sprintf("192.168.%d.%d", i/256, i%256))
+	}
+
+	if got := sh.Len(); got != size {
+		t.Errorf("wrong number of tracked IPs: want = %d, got = %d", size, got)
+	}
+	if got := sh.Peek("10.0.0.1"); got != 100*size {
+		t.Errorf("wrong counter of active IP: want = %d, got = %d", 100*size, got)
+	}
+
+	// only the most recent IPs of the spray are tracked
+	if got := sh.Peek("192.168.0.0"); got != 0 {
+		t.Errorf("oldest IP is not evicted: want = %d, got = %d", 0, got)
+	}
+	last := 100*size - 1
+	if got := sh.Peek(fmt.Sprintf("192.168.%d.%d", last/256, last%256)); got != 1 {
+		t.Errorf("newest IP is evicted: want = %d, got = %d", 1, got)
+	}
+}
+
+func TestLRUStatHolder_Peek(t *testing.T) {
+	sh := NewLRUStatHolder(2)
+
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.2")
+
+	// peeking doesn't make 127.0.0.1 recently used
+	if got := sh.Peek("127.0.0.1"); got != 1 {
+		t.Errorf("wrong peeked counter: want = %d, got = %d", 1, got)
+	}
+	sh.Increment("127.0.0.3")
+
+	if got := sh.Peek("127.0.0.1"); got != 0 {
+		t.Errorf("peeked counter is not evicted: want = %d, got = %d", 0, got)
+	}
+}
+
+func TestLRUStatHolder_Reset(t *testing.T) {
+	sh := NewLRUStatHolder(10)
+
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.1")
+
+	sh.Reset()
+
+	if got := sh.Len(); got != 0 {
+		t.Errorf("wrong number of tracked IPs: want = %d, got = %d", 0, got)
+	}
+	if got := sh.Increment("127.0.0.1"); got != 1 {
+		t.Errorf("counter is not reset: want = %d, got = %d", 1, got)
+	}
+}
+
+func TestLRUStatHolder_concurrent(t *testing.T) {
+	sh := NewLRUStatHolder(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sh.Increment(fmt.Sprintf("127.0.%d.%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := sh.Len(); got != 10 {
+		t.Errorf("wrong number of tracked IPs: want = %d, got = %d", 10, got)
+	}
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// manifestHeader is a response header holding a manifest hash of results.
+const manifestHeader = "X-Manifest"
+
+// manifest returns a hex-encoded SHA-256 hash of a canonical form of given results,
+// which doesn't depend on an order of the results.
+//
+// The canonical form is a line "<url>\t<size>\n" per result, the lines sorted bytewise.
+// The size is a decimal number of bytes of a fetched URL, "skipped" for a skipped one and "error" for a failed one.
+func manifest(results resultSource) (string, error) {
+	lines := make([]string, 0)
+
+	err := results.each(func(res Result) error {
+		size := strconv.Itoa(res.Size)
+		switch {
+		case res.Skipped != "":
+			size = "skipped"
+		case res.Error != "":
+			size = "error"
+		}
+
+		lines = append(lines, res.URL+"\t"+size+"\n")
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, line := range lines {
+		_, _ = h.Write([]byte(line))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
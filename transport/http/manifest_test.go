@@ -0,0 +1,113 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestManifest(t *testing.T) {
+	results := []Result{
+		{URL: "https://test-2.com", Size: 20},
+		{URL: "https://test-1.com", Size: 10},
+		{URL: "https://test-3.com", Error: "timeout"},
+		{URL: "https://test-4.com", Skipped: skippedByType},
+	}
+
+	sum := sha256.Sum256([]byte("https://test-1.com\t10\nhttps://test-2.com\t20\nhttps://test-3.com\terror\nhttps://test-4.com\tskipped\n"))
+	want := hex.EncodeToString(sum[:])
+
+	got, err := manifest(resultSlice(results))
+	if err != nil {
+		t.Fatalf("cannot compute manifest: %s", err)
+	}
+	if got != want {
+		t.Errorf("wrong manifest: want = %s, got = %s", want, got)
+	}
+
+	reordered := []Result{results[3], results[1], results[2], results[0]}
+	if got, _ := manifest(resultSlice(reordered)); got != want {
+		t.Errorf("manifest depends on order of results: want = %s, got = %s", want, got)
+	}
+
+	changed := append([]Result{}, results...)
+	changed[1].Size = 11
+	if got, _ := manifest(resultSlice(changed)); got == want {
+		t.Error("manifest doesn't change along with a size")
+	}
+}
+
+func TestWithManifest(t *testing.T) {
+	// URLs complete in the order of given delays
+	serve := func(delays map[string]time.Duration) (string, string) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		client := http_mock.NewMockClient(ctrl)
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			time.Sleep(delays[req.URL.String()])
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+			}, nil
+		}).Times(len(delays))
+
+		handler := newResponseSizeCounter(t, WithManifest(true))
+		handler.SetClient(client)
+
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{RawQuery: "format=json&summary=true"},
+			Body:   io.NopCloser(strings.NewReader("https://test-1.com\nhttps://test-22.com\nhttps://test-333.com")),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		var body struct {
+			Results  []Result `json:"results"`
+			Summary  Summary  `json:"summary"`
+			Manifest string   `json:"manifest"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("cannot decode response body: %s", err)
+		}
+
+		if len(body.Results) != 3 || body.Summary.P50 != len("test-22.com") {
+			t.Errorf("wrong results along with manifest: %+v", body)
+		}
+
+		return w.Header().Get(manifestHeader), body.Manifest
+	}
+
+	header, field := serve(map[string]time.Duration{
+		"https://test-1.com":   0,
+		"https://test-22.com":  10 * time.Millisecond,
+		"https://test-333.com": 20 * time.Millisecond,
+	})
+	if header == "" || header != field {
+		t.Errorf("manifest header and field differ: header = %s, field = %s", header, field)
+	}
+
+	reversed, _ := serve(map[string]time.Duration{
+		"https://test-1.com":   20 * time.Millisecond,
+		"https://test-22.com":  10 * time.Millisecond,
+		"https://test-333.com": 0,
+	})
+	if reversed != header {
+		t.Errorf("manifest depends on order of completion: want = %s, got = %s", header, reversed)
+	}
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// metricsPath is a path MakeResponseSizeCounter serves metrics at, if enabled.
+const metricsPath = "/metrics"
+
+// metricsContentType is a content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metrics holds counters of a handler, accessed atomically.
+//
+// The counters are 64-bit ones, so metrics must be the first field of a struct it's a part of
+// to be aligned on 32-bit platforms.
+type metrics struct {
+	requests  int64
+	succeeded int64
+	failed    int64
+	skipped   int64
+	bytes     int64
+	// latency is a sum of latencies of fetched URLs, in nanoseconds.
+	latency int64
+}
+
+// observe counts a result of fetching a URL.
+func (m *metrics) observe(result Result, err error) {
+	switch {
+	case result.Skipped != "":
+		atomic.AddInt64(&m.skipped, 1)
+		return
+	case err != nil:
+		atomic.AddInt64(&m.failed, 1)
+	default:
+		atomic.AddInt64(&m.succeeded, 1)
+		atomic.AddInt64(&m.bytes, int64(result.Size))
+	}
+
+	atomic.AddInt64(&m.latency, int64(result.Latency))
+}
+
+// writeTo writes the counters in the Prometheus text exposition format.
+func (m *metrics) writeTo(w io.Writer) error {
+	succeeded, failed := atomic.LoadInt64(&m.succeeded), atomic.LoadInt64(&m.failed)
+	latency := time.Duration(atomic.LoadInt64(&m.latency))
+
+	_, err := fmt.Fprintf(w, `# HELP response_size_counter_requests_total Requests served by the handler.
+# TYPE response_size_counter_requests_total counter
+response_size_counter_requests_total %d
+# HELP response_size_counter_fetches_total URLs handled by outcome.
+# TYPE response_size_counter_fetches_total counter
+response_size_counter_fetches_total{outcome="succeeded"} %d
+response_size_counter_fetches_total{outcome="failed"} %d
+response_size_counter_fetches_total{outcome="skipped"} %d
+# HELP response_size_counter_response_bytes_total Bytes of responses to successfully fetched URLs.
+# TYPE response_size_counter_response_bytes_total counter
+response_size_counter_response_bytes_total %d
+# HELP response_size_counter_fetch_latency_seconds Latency of fetched URLs.
+# TYPE response_size_counter_fetch_latency_seconds summary
+response_size_counter_fetch_latency_seconds_sum %g
+response_size_counter_fetch_latency_seconds_count %d
+`,
+		atomic.LoadInt64(&m.requests),
+		succeeded, failed, atomic.LoadInt64(&m.skipped),
+		atomic.LoadInt64(&m.bytes),
+		latency.Seconds(), succeeded+failed,
+	)
+
+	return err
+}
+
+// MetricsHandler returns a handler responding to GET requests with counters of the handler
+// in the Prometheus text exposition format, so it is able to be scraped without a client library.
+func (h *ResponseSizeCounter) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET method supported.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", metricsContentType)
+
+		_ = h.metrics.writeTo(w)
+	})
+}
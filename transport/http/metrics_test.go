@@ -0,0 +1,67 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMakeResponseSizeCounter_metrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			panic(http.ErrAbortHandler)
+		}
+		_, _ = w.Write([]byte(strings.Repeat("0", 100)))
+	}))
+	defer srv.Close()
+
+	handler := MakeResponseSizeCounter(WithMetricsEndpoint(true))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(srv.URL+"/a\n"+srv.URL+"/b\n"+srv.URL+"/missing")))
+
+	// scrapes are not limited, so the limit of the rest of routes is exceeded
+	for i := 0; i <= defaultRateLimit; i++ {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong response status of scrape #%d: want = %d, got = %d", i, http.StatusOK, w.Code)
+		}
+	}
+
+	if got := w.Header().Get("Content-Type"); got != metricsContentType {
+		t.Errorf("wrong content type: want = %s, got = %s", metricsContentType, got)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE response_size_counter_requests_total counter",
+		// the posted request and the scrapes, the last one included
+		fmt.Sprintf("response_size_counter_requests_total %d\n", defaultRateLimit+2),
+		"# TYPE response_size_counter_fetches_total counter",
+		`response_size_counter_fetches_total{outcome="succeeded"} 2`,
+		`response_size_counter_fetches_total{outcome="failed"} 1`,
+		`response_size_counter_fetches_total{outcome="skipped"} 0`,
+		"response_size_counter_response_bytes_total 200\n",
+		"# TYPE response_size_counter_fetch_latency_seconds summary",
+		"response_size_counter_fetch_latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics miss %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMakeResponseSizeCounter_metricsDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	MakeResponseSizeCounter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// the request is handled by the counter itself
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -1,9 +1,19 @@
 package http
 
 import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,34 +21,71 @@ import (
 type Stat interface {
 	// Reset performs statistics flushing.
 	//
-	// Reset is supposed to be called after each agreed time interval.
+	// Reset is supposed to be called at the beginning of each agreed time interval.
+	// Increments made after Reset returns must count from zero.
 	Reset()
 
 	// Increment increases a counter of requests from a given IP by 1.
 	//
 	// This operation collects statistics for each IP to decide if a rate limit is exceeded.
 	Increment(id string) int32
+
+	// Peek returns a counter of requests from a given IP without changing it.
+	//
+	// It is supposed to be used by monitoring, zero is returned for unknown IPs.
+	Peek(id string) int32
+
+	// Close releases resources held by statistics, e.g. connections to a remote storage.
+	//
+	// Close is supposed to be called once on the middleware teardown.
+	Close() error
 }
 
 // StatHolder is a default implementation of Stat.
 type StatHolder struct {
 	mu      sync.RWMutex
 	counter map[string]int32
+	// seen holds a time of the last increment of each counter.
+	seen map[string]time.Time
+
+	// now is a time source of increments.
+	now func() time.Time
 }
 
 // NewStatHolder returns a new instance of StatHolder.
 func NewStatHolder() *StatHolder {
 	return &StatHolder{
 		counter: make(map[string]int32),
+		seen:    make(map[string]time.Time),
+		now:     time.Now,
 	}
 }
 
-// Reset clears underlying counter map.
+// Reset clears counters of all IPs.
+//
+// Reset is atomic with respect to Increment: an increment either happens before Reset and is cleared,
+// or happens after it and counts from zero.
 func (sh *StatHolder) Reset() {
 	sh.mu.Lock()
 	defer sh.mu.Unlock()
 
 	sh.counter = make(map[string]int32)
+	sh.seen = make(map[string]time.Time)
+}
+
+// ResetExpired clears counters of IPs not incremented for a given window,
+// counters of active IPs are kept.
+func (sh *StatHolder) ResetExpired(window time.Duration) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	expired := sh.now().Add(-window)
+	for id, seen := range sh.seen {
+		if !seen.After(expired) {
+			delete(sh.counter, id)
+			delete(sh.seen, id)
+		}
+	}
 }
 
 // Increment adds 1 to a counter of requests incoming from a given IP.
@@ -47,42 +94,468 @@ func (sh *StatHolder) Increment(id string) int32 {
 	defer sh.mu.Unlock()
 
 	sh.counter[id]++
+	sh.seen[id] = sh.now()
+
+	return sh.counter[id]
+}
+
+// Peek returns a counter of requests incoming from a given IP.
+func (sh *StatHolder) Peek(id string) int32 {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
 	return sh.counter[id]
 }
 
+// Close does nothing as StatHolder holds no resources to release.
+func (sh *StatHolder) Close() error {
+	return nil
+}
+
+// RateLimiter holds a state of a rate limiting middleware.
+type RateLimiter struct {
+	// limit is accessed atomically, so it is able to be changed while requests are served.
+	limit  int64
+	window time.Duration
+	stat   Stat
+
+	// burst is a number of requests each IP is allowed to make over the limit at a time window, if set.
+	burst int
+
+	// now is a time source both windows and Retry-After values are computed with.
+	now func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	// bursts holds a state of a burst allowance of each IP which has exceeded the limit recently.
+	bursts map[string]burstState
+}
+
+// burstState tells whether an IP is allowed to burst over the limit at a time window starting at a given time.
+type burstState struct {
+	window  time.Time
+	allowed bool
+}
+
+// LimiterOption configures a RateLimiter.
+type LimiterOption func(rl *RateLimiter)
+
+// WithClock sets a time source of a RateLimiter. Default is time.Now.
+func WithClock(now func() time.Time) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.now = now
+	}
+}
+
+// WithBurst allows each IP to make up to n requests over the limit at a time window,
+// unless the IP has exceeded the limit at the previous window as well.
+//
+// So a client which is usually within the limit is able to send a short burst of requests,
+// while a client exceeding the limit all the time is throttled to it since the second window.
+func WithBurst(n int) LimiterOption {
+	return func(rl *RateLimiter) {
+		rl.burst = n
+	}
+}
+
+// NewRateLimiter returns a new instance of RateLimiter
+// allowing limit requests from each IP at a time window.
+func NewRateLimiter(limit int, window time.Duration, stat Stat, opts ...LimiterOption) *RateLimiter {
+	rl := &RateLimiter{
+		limit:  int64(limit),
+		window: window,
+		stat:   stat,
+		now:    time.Now,
+		bursts: make(map[string]burstState),
+	}
+
+	for _, opt := range opts {
+		opt(rl)
+	}
+
+	rl.windowStart = rl.now()
+
+	return rl
+}
+
 // RateLimit creates a middleware wrapping a given handler.
 // It allows to set a rate limit for requests from each IP at a certain time window.
-func RateLimit(limit int, window time.Duration, stat Stat) func(next http.Handler) http.Handler {
+func RateLimit(limit int, window time.Duration, stat Stat, opts ...LimiterOption) func(next http.Handler) http.Handler {
 	// I'd rather use Limiter from golang.org/x/time/rate package,
 	// but here we go
-	ticker := time.NewTicker(window)
-	go func() {
-		for range ticker.C {
-			stat.Reset()
+	return NewRateLimiter(limit, window, stat, opts...).Handler
+}
+
+// Handler wraps a given handler with the rate limit.
+//
+// Requests exceeding the limit, along with the burst allowance, if any, are responded with 429 status
+// and Retry-After header holding a number of seconds left till the end of the current window.
+func (rl *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqIP, err := requestIP(req)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
 		}
-	}()
+
+		left := rl.advance()
+
+		current := int(rl.stat.Increment(reqIP))
+
+		if over := current - int(atomic.LoadInt64(&rl.limit)); over > 0 && !rl.allowBurst(reqIP, over) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter(left)))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// SetLimit changes a number of requests allowed from each IP at a time window.
+//
+// It is safe to call SetLimit concurrently with serving requests:
+// the new limit is applied to every request checked after SetLimit returns,
+// including requests from IPs which have already been counted in the current window.
+func (rl *RateLimiter) SetLimit(limit int) {
+	atomic.StoreInt64(&rl.limit, int64(limit))
+}
+
+// Limit returns a number of requests allowed from each IP at a time window.
+func (rl *RateLimiter) Limit() int {
+	return int(atomic.LoadInt64(&rl.limit))
+}
+
+// Reset clears counters of all IPs and their burst allowances at once, so every IP is allowed
+// as many requests as at the beginning of a window. The current window goes on.
+func (rl *RateLimiter) Reset() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.stat.Reset()
+	rl.bursts = make(map[string]burstState)
+}
+
+// rateLimitResetPath is a path MakeResponseSizeCounter serves ResetHandler of its rate limiter at, if enabled.
+const rateLimitResetPath = "/admin/rate-limit/reset"
+
+// ResetHandler returns a handler resetting the rate limiter on POST requests, responded with 204 status.
+//
+// The handler is not protected by itself, it is supposed to be wrapped with BasicAuth or a similar middleware.
+func (rl *RateLimiter) ResetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Only POST method supported.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rl.Reset()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Close releases resources held by underlying statistics.
+//
+// The rate limiter must not be used after Close is called.
+func (rl *RateLimiter) Close() error {
+	return rl.stat.Close()
+}
+
+// advance resets statistics if the current window is over and returns the time left till the end of the window.
+func (rl *RateLimiter) advance() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	elapsed := rl.now().Sub(rl.windowStart)
+	if elapsed >= rl.window {
+		rl.stat.Reset()
+		rl.windowStart = rl.windowStart.Add(elapsed.Truncate(rl.window))
+		elapsed -= elapsed.Truncate(rl.window)
+
+		// states of IPs which haven't exceeded the limit at the previous window don't affect next ones
+		previous := rl.windowStart.Add(-rl.window)
+		for ip, state := range rl.bursts {
+			if state.window.Before(previous) {
+				delete(rl.bursts, ip)
+			}
+		}
+	}
+
+	return rl.window - elapsed
+}
+
+// allowBurst tells whether a request from a given IP being a given number of requests over the limit
+// is allowed by the burst allowance at the current window.
+//
+// The IP is allowed to burst unless it has exceeded the limit at the previous window.
+func (rl *RateLimiter) allowBurst(ip string, over int) bool {
+	if rl.burst <= 0 {
+		return false
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	state, ok := rl.bursts[ip]
+	if !ok || !state.window.Equal(rl.windowStart) {
+		previous := rl.windowStart.Add(-rl.window)
+		state = burstState{window: rl.windowStart, allowed: !ok || !state.window.Equal(previous)}
+		rl.bursts[ip] = state
+	}
+
+	return state.allowed && over <= rl.burst
+}
+
+// retryAfter rounds a given duration up to whole seconds, at least one.
+func retryAfter(left time.Duration) int {
+	seconds := int((left + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
+
+// Chain composes given middlewares into a single one.
+//
+// The first middleware is the outermost one: Chain(a, b)(h) handles a request by a, then b, then h.
+func Chain(mw ...func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+
+		return next
+	}
+}
+
+// BasicAuth creates a middleware wrapping a given handler.
+// It allows requests having HTTP basic authentication credentials matching one of given username to password pairs,
+// other requests are responded with 401 status and WWW-Authenticate header of a given realm.
+//
+// It is supposed to be composed before RateLimit, e.g. Chain(BasicAuth(realm, credentials), RateLimit(...)).
+func BasicAuth(realm string, credentials map[string]string) func(next http.Handler) http.Handler {
+	// passwords are compared by hashes, so a comparison takes the same time whatever their lengths are
+	hashes := make(map[string][sha256.Size]byte, len(credentials))
+	for username, password := range credentials {
+		hashes[username] = sha256.Sum256([]byte(password))
+	}
+
+	challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			reqIP, err := requestIP(req)
-			if err != nil {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			username, password, ok := req.BasicAuth()
+			if ok {
+				want, known := hashes[username]
+				got := sha256.Sum256([]byte(password))
+				ok = subtle.ConstantTimeCompare(want[:], got[:]) == 1 && known
+			}
+
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
 			}
 
-			current := int(stat.Increment(reqIP))
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// Logger is a contract of a destination of log lines, e.g. *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// AccessLog creates a middleware wrapping a given handler.
+// It logs a line per handled request with a given logger once the request is handled:
+// its method, URI, response status, number of written body bytes and duration of handling, e.g.
+//
+//	POST /?format=json 200 1024 12.5ms
+//
+// It is supposed to be the outermost middleware, so the duration covers other middlewares as well.
+func AccessLog(logger Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			lw := &loggingResponseWriter{ResponseWriter: w}
+
+			defer func() {
+				logger.Printf("%s %s %d %d %s", req.Method, req.URL.RequestURI(), lw.statusCode(), lw.written, time.Since(start))
+			}()
+
+			next.ServeHTTP(lw, req)
+		})
+	}
+}
+
+// loggingResponseWriter is an implementation of http.ResponseWriter capturing a response status and a body size.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// WriteHeader captures a given status, only the first one is sent.
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts given bytes written.
+func (w *loggingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+
+	return n, err
+}
+
+// Flush sends buffered data to a client, if the underlying writer supports it, so streamed results keep streaming.
+func (w *loggingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over a connection of the underlying writer, e.g. to upgrade it to a WebSocket.
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController reaches it.
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
 
-			if limit < current {
-				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+// statusCode returns a status of a response, 200 if nothing is written as a server responds with it.
+func (w *loggingResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// Gzip creates a middleware wrapping a given handler.
+// It compresses responses with a given compression level for clients accepting gzip encoding.
+func Gzip(level int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			// a response upgrading a connection has no body to compress
+			if !acceptsGzip(req) || req.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, req)
 				return
 			}
 
-			next.ServeHTTP(w, req)
+			gz, err := gzip.NewWriterLevel(w, level)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			defer closeGzipWriter(gz)
+
+			w.Header().Set("Content-Encoding", "gzip")
+
+			next.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, gz: gz}, req)
 		})
 	}
 }
 
+// gzipResponseWriter is an implementation of http.ResponseWriter compressing a written body.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+// WriteHeader drops Content-Length header as it doesn't match a compressed body.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses given bytes.
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	return w.gz.Write(b)
+}
+
+// Flush writes bytes compressed so far to the underlying writer and flushes it, if it supports flushing,
+// so streamed responses reach a client as they are written.
+func (w *gzipResponseWriter) Flush() {
+	if err := w.gz.Flush(); err != nil {
+		log.Printf("flush gzip writer: %s", err)
+		return
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController reaches its features, e.g. write deadlines.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// acceptsGzip reports whether a given request accepts gzip content coding.
+// The coding is refused by a zero weight, e.g. 'gzip;q=0.000', or by a weight failing to be parsed.
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return codingWeight(params) > 0
+		}
+	}
+
+	return false
+}
+
+// codingWeight returns a weight given by 'q' parameter of given content coding parameters,
+// 1 if there is none and 0 if it fails to be parsed.
+func codingWeight(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(param, "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0
+		}
+
+		return q
+	}
+
+	return 1
+}
+
+func closeGzipWriter(gz *gzip.Writer) {
+	if err := gz.Close(); err != nil {
+		log.Printf("close gzip writer: %s", err)
+	}
+}
+
 func requestIP(req *http.Request) (string, error) {
 	// in real production we should check X-REAL-IP, X-FORWARDED-FOR... request headers
 	// to prevent the case when client is behind proxy, uses load balancer or so
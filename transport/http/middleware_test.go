@@ -1,8 +1,14 @@
 package http
 
 import (
+	"compress/gzip"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,6 +63,527 @@ func TestRateLimit_wrongRequestIP(t *testing.T) {
 	}
 }
 
+func TestRateLimit_retryAfter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rl := RateLimit(1, 10*time.Second, NewStatHolder(), WithClock(clock.Now))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := http_mock.NewMockHandler(ctrl)
+	{
+		h.EXPECT().ServeHTTP(gomock.Any(), gomock.Any()).Times(2)
+	}
+
+	rl(h).ServeHTTP(httptest.NewRecorder(), requestWithIP("127.0.0.1:80"))
+
+	steps := []struct {
+		advance time.Duration
+		want    string
+	}{
+		{advance: 0, want: "10"},
+		{advance: 4 * time.Second, want: "6"},
+		{advance: 5500 * time.Millisecond, want: "1"},
+	}
+
+	for _, step := range steps {
+		clock.Advance(step.advance)
+
+		w := httptest.NewRecorder()
+		rl(h).ServeHTTP(w, requestWithIP("127.0.0.1:80"))
+
+		res := w.Result()
+		if res.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Wrong response status: want = %d, got = %d", http.StatusTooManyRequests, res.StatusCode)
+		}
+
+		if got := res.Header.Get("Retry-After"); got != step.want {
+			t.Errorf("Wrong Retry-After: want = %s, got = %s", step.want, got)
+		}
+	}
+
+	clock.Advance(time.Second)
+
+	w := httptest.NewRecorder()
+	rl(h).ServeHTTP(w, requestWithIP("127.0.0.1:80"))
+
+	if res := w.Result(); res.StatusCode != http.StatusOK {
+		t.Errorf("Wrong response status after window reset: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestRateLimit_burst(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rl := RateLimit(2, 10*time.Second, NewStatHolder(), WithClock(clock.Now), WithBurst(3))
+	handler := rl(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	served := func(ip string, n int) int {
+		ok := 0
+		for i := 0; i < n; i++ {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, requestWithIP(ip))
+			if w.Code == http.StatusOK {
+				ok++
+			}
+		}
+		return ok
+	}
+
+	steps := []struct {
+		name     string
+		requests int
+		want     int
+	}{
+		{name: "short burst", requests: 6, want: 5},
+		{name: "sustained over-rate", requests: 6, want: 2},
+		{name: "still over-rate", requests: 3, want: 2},
+		{name: "within limit", requests: 2, want: 2},
+		{name: "burst after a quiet window", requests: 6, want: 5},
+	}
+
+	for _, step := range steps {
+		if got := served("127.0.0.1:80", step.requests); got != step.want {
+			t.Errorf("%s: wrong number of served requests: want = %d, got = %d", step.name, step.want, got)
+		}
+		clock.Advance(10 * time.Second)
+	}
+
+	if got := served("127.0.0.2:80", 6); got != 5 {
+		t.Errorf("burst of another IP: wrong number of served requests: want = %d, got = %d", 5, got)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	track := func(name string) func(next http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name+" in")
+				next.ServeHTTP(w, req)
+				calls = append(calls, name+" out")
+			})
+		}
+	}
+
+	handler := Chain(track("first"), track("second"), track("third"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		calls = append(calls, "handler")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), request())
+
+	want := []string{"first in", "second in", "third in", "handler", "third out", "second out", "first out"}
+	if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+		t.Errorf("wrong invocation order: want = %v, got = %v", want, calls)
+	}
+
+	if Chain()(handler) == nil {
+		t.Error("empty chain lost the handler")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	credentials := map[string]string{"admin": "s3cret", "viewer": "pa55"}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		header   bool
+		want     int
+	}{
+		{name: "valid", username: "admin", password: "s3cret", header: true, want: http.StatusOK},
+		{name: "valid of another user", username: "viewer", password: "pa55", header: true, want: http.StatusOK},
+		{name: "wrong password", username: "admin", password: "pa55", header: true, want: http.StatusUnauthorized},
+		{name: "unknown user", username: "guest", password: "s3cret", header: true, want: http.StatusUnauthorized},
+		{name: "missing header", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			h := http_mock.NewMockHandler(ctrl)
+			if tt.want == http.StatusOK {
+				h.EXPECT().ServeHTTP(gomock.Any(), gomock.Any())
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+
+			w := httptest.NewRecorder()
+
+			BasicAuth("sizes", credentials)(h).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("wrong response status: want = %d, got = %d", tt.want, w.Code)
+			}
+
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusUnauthorized && challenge != `Basic realm="sizes", charset="UTF-8"` {
+				t.Errorf("wrong WWW-Authenticate header: %s", challenge)
+			}
+		})
+	}
+}
+
+// lineLogger is a Logger collecting formatted lines.
+type lineLogger struct {
+	lines []string
+}
+
+func (l *lineLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "results", query: "format=json", status: http.StatusOK},
+		{name: "streamed results", query: "format=ndjson", status: http.StatusOK},
+		{name: "wrong query", query: "slowest=-1", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsc := newResponseSizeCounter(t)
+			rsc.SetClient(StaticGetter{Size: 100})
+
+			logger := &lineLogger{}
+			handler := AccessLog(logger)(rsc)
+
+			req := LoadTestRequest(3, tt.query)
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if len(logger.lines) != 1 {
+				t.Fatalf("wrong number of logged lines: want = %d, got = %v", 1, logger.lines)
+			}
+
+			fields := strings.Fields(logger.lines[0])
+			if len(fields) != 5 {
+				t.Fatalf("wrong logged line: %s", logger.lines[0])
+			}
+
+			want := []string{http.MethodPost, "/?" + tt.query, strconv.Itoa(tt.status), strconv.Itoa(w.Body.Len())}
+			if strings.Join(fields[:4], " ") != strings.Join(want, " ") {
+				t.Errorf("wrong logged fields: want = %v, got = %v", want, fields[:4])
+			}
+
+			if w.Code != tt.status {
+				t.Errorf("wrong status: want = %d, got = %d", tt.status, w.Code)
+			}
+
+			if _, err := time.ParseDuration(fields[4]); err != nil {
+				t.Errorf("wrong logged duration: %s", err)
+			}
+		})
+	}
+}
+
+func TestAccessLog_flush(t *testing.T) {
+	handler := AccessLog(&lineLogger{})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("wrapped writer is not a flusher")
+		}
+		flusher.Flush()
+
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("wrapped writer is not a hijacker")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, LoadTestRequest(1, ""))
+
+	if !w.Flushed {
+		t.Error("response is not flushed")
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat("25000\n", 100)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := http_mock.NewMockHandler(ctrl)
+	{
+		h.EXPECT().ServeHTTP(gomock.Any(), gomock.Any()).Do(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}).Times(2)
+	}
+
+	gz := Gzip(gzip.BestCompression)
+
+	t.Run("compressed", func(t *testing.T) {
+		req := requestWithIP("127.0.0.1:80")
+		req.Header = http.Header{"Accept-Encoding": []string{"deflate, gzip"}}
+
+		w := httptest.NewRecorder()
+		gz(h).ServeHTTP(w, req)
+
+		res := w.Result()
+		defer closeResBody(res.Body)
+
+		if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Wrong Content-Encoding: want = %s, got = %s", "gzip", got)
+		}
+
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			t.Fatalf("cannot read gzip response: %s", err)
+		}
+
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot decompress response: %s", err)
+		}
+
+		if string(got) != body {
+			t.Errorf("Wrong decompressed body: want = %q, got = %q", body, string(got))
+		}
+	})
+
+	t.Run("uncompressed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		gz(h).ServeHTTP(w, requestWithIP("127.0.0.1:80"))
+
+		res := w.Result()
+		defer closeResBody(res.Body)
+
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("Unexpected Content-Encoding: %s", got)
+		}
+
+		got, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("cannot read response: %s", err)
+		}
+
+		if string(got) != body {
+			t.Errorf("Wrong body: want = %q, got = %q", body, string(got))
+		}
+	})
+}
+
+func Test_acceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "deflate", want: false},
+		{header: "gzip", want: true},
+		{header: "deflate, GZIP", want: true},
+		{header: "gzip;q=0.5", want: true},
+		{header: "gzip; q=1", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "gzip;q=0.0", want: false},
+		{header: "gzip;q=0.000", want: false},
+		{header: "gzip;Q=0", want: false},
+		{header: "gzip ; q = 0", want: false},
+		{header: "gzip;q=none", want: false},
+	}
+
+	for _, tt := range tests {
+		req := requestWithIP("127.0.0.1:80")
+		req.Header = http.Header{"Accept-Encoding": []string{tt.header}}
+
+		if got := acceptsGzip(req); got != tt.want {
+			t.Errorf("wrong gzip acceptance of %q: want = %t, got = %t", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimiter_SetLimit(t *testing.T) {
+	rl := NewRateLimiter(5, time.Minute, NewStatHolder())
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := http_mock.NewMockHandler(ctrl)
+	{
+		h.EXPECT().ServeHTTP(gomock.Any(), gomock.Any()).Times(3)
+	}
+
+	statuses := make([]int, 0)
+	for i := 0; i < 5; i++ {
+		if i == 2 {
+			rl.SetLimit(3)
+		}
+
+		w := httptest.NewRecorder()
+		rl.Handler(h).ServeHTTP(w, requestWithIP("127.0.0.1:80"))
+
+		statuses = append(statuses, w.Result().StatusCode)
+	}
+
+	want := []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("Wrong response status of request #%d: want = %d, got = %d", i, want[i], statuses[i])
+		}
+	}
+
+	if rl.Limit() != 3 {
+		t.Errorf("Wrong limit: want = %d, got = %d", 3, rl.Limit())
+	}
+}
+
+func TestRateLimiter_ResetHandler(t *testing.T) {
+	stat := NewStatHolder()
+	rl := NewRateLimiter(1, time.Minute, stat, WithBurst(1))
+	limited := rl.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		limited.ServeHTTP(httptest.NewRecorder(), requestWithIP("127.0.0.1:80"))
+	}
+	if got := stat.Peek("127.0.0.1"); got != 3 {
+		t.Fatalf("wrong counter before reset: want = %d, got = %d", 3, got)
+	}
+
+	w := httptest.NewRecorder()
+	rl.ResetHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, rateLimitResetPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong response status of GET: want = %d, got = %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	rl.ResetHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, rateLimitResetPath, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusNoContent, w.Code)
+	}
+
+	if got := stat.Peek("127.0.0.1"); got != 0 {
+		t.Errorf("counter is not cleared: %d", got)
+	}
+
+	// the burst allowance is restored along with the counter
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		limited.ServeHTTP(w, requestWithIP("127.0.0.1:80"))
+		if w.Code != http.StatusOK {
+			t.Errorf("wrong response status of request #%d after reset: want = %d, got = %d", i, http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestRateLimiter_Close(t *testing.T) {
+	stat := &closingStat{StatHolder: NewStatHolder()}
+	rl := NewRateLimiter(3, time.Second, stat)
+
+	if err := rl.Close(); err != nil {
+		t.Errorf("cannot close rate limiter: %s", err)
+	}
+
+	if stat.closed != 1 {
+		t.Errorf("Wrong Stat.Close calls count: want = %d, got = %d", 1, stat.closed)
+	}
+}
+
+// closingStat is a Stat counting Close calls.
+type closingStat struct {
+	*StatHolder
+	closed int
+}
+
+func (s *closingStat) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestStatHolder_Reset(t *testing.T) {
+	sh := NewStatHolder()
+
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.2")
+
+	sh.Reset()
+
+	for _, id := range []string{"127.0.0.1", "127.0.0.2"} {
+		if got := sh.Increment(id); got != 1 {
+			t.Errorf("counter of %s is not reset: want = %d, got = %d", id, 1, got)
+		}
+	}
+}
+
+func TestStatHolder_Peek(t *testing.T) {
+	sh := NewStatHolder()
+
+	if got := sh.Peek("127.0.0.1"); got != 0 {
+		t.Errorf("wrong counter of unknown IP: want = %d, got = %d", 0, got)
+	}
+
+	sh.Increment("127.0.0.1")
+	sh.Increment("127.0.0.1")
+
+	for i := 0; i < 2; i++ {
+		if got := sh.Peek("127.0.0.1"); got != 2 {
+			t.Errorf("wrong peeked counter: want = %d, got = %d", 2, got)
+		}
+	}
+
+	if got := sh.Increment("127.0.0.1"); got != 3 {
+		t.Errorf("counter is changed by Peek: want = %d, got = %d", 3, got)
+	}
+}
+
+func TestStatHolder_ResetExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	sh := NewStatHolder()
+	sh.now = clock.Now
+
+	sh.Increment("stale")
+	sh.Increment("active")
+
+	clock.Advance(5 * time.Second)
+	sh.Increment("active")
+
+	clock.Advance(6 * time.Second)
+	sh.ResetExpired(10 * time.Second)
+
+	if got := sh.Increment("stale"); got != 1 {
+		t.Errorf("stale counter is not pruned: want = %d, got = %d", 1, got)
+	}
+
+	if got := sh.Increment("active"); got != 3 {
+		t.Errorf("active counter is pruned: want = %d, got = %d", 3, got)
+	}
+}
+
+// fakeClock is a manually advanced time source.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
 func requestWithIP(ip string) *http.Request {
 	return &http.Request{
 		Method:     http.MethodGet,
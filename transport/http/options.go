@@ -0,0 +1,702 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	net_url "net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Option configures a ResponseSizeCounter.
+type Option func(h *ResponseSizeCounter)
+
+// WithMaxHeaderBytes limits a size of response headers of outbound requests.
+//
+// Requests to URLs responding with larger headers fail instead of consuming unbounded memory.
+func WithMaxHeaderBytes(n int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.transport.MaxResponseHeaderBytes = n
+	}
+}
+
+// WithCABundle makes the default client trust certificates of a given PEM bundle along with system roots,
+// e.g. of an internal CA. NewResponseSizeCounter fails if the bundle holds no certificates.
+func WithCABundle(pem []byte) Option {
+	return func(h *ResponseSizeCounter) {
+		pool, err := caPool(pem)
+		if err != nil {
+			h.optionErrs = append(h.optionErrs, fmt.Errorf("%w: CA bundle: %w", errInvalidOption, err))
+			return
+		}
+		withRootCAs(h.transport, pool)
+	}
+}
+
+// WithNamedCABundle registers a PEM bundle of certificates requests are able to select
+// with X-CA-Bundle header naming it. https URLs of such a request are fetched by the default client
+// trusting the bundle along with system roots instead of roots it trusts otherwise.
+//
+// Requests naming an unknown bundle are rejected with 400 status.
+// NewResponseSizeCounter fails if the bundle holds no certificates.
+func WithNamedCABundle(name string, pem []byte) Option {
+	return func(h *ResponseSizeCounter) {
+		pool, err := caPool(pem)
+		if err != nil {
+			h.optionErrs = append(h.optionErrs, fmt.Errorf("%w: CA bundle %q: %w", errInvalidOption, name, err))
+			return
+		}
+		if h.caBundles == nil {
+			h.caBundles = make(map[string]*x509.CertPool)
+		}
+		h.caBundles[name] = pool
+	}
+}
+
+// WithDisableKeepAlives makes the default client open a fresh connection for every fetch when disable is true,
+// so targets are measured without connection reuse.
+func WithDisableKeepAlives(disable bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.transport.DisableKeepAlives = disable
+	}
+}
+
+// WithConnectionPool tunes a pool of connections the default client keeps alive between fetches.
+// The pool is shared by all requests the handler serves, so requests fetching the same hosts reuse connections.
+//
+// maxIdle limits idle connections in total and maxIdlePerHost limits them per host,
+// which is 2 by default and worth raising when many URLs of a request share a host.
+// maxPerHost limits all connections per host, including active ones, and idleTimeout
+// closes connections idle for longer. Non-positive values keep defaults.
+func WithConnectionPool(maxIdle, maxIdlePerHost, maxPerHost int, idleTimeout time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		if maxIdle > 0 {
+			h.transport.MaxIdleConns = maxIdle
+		}
+		if maxIdlePerHost > 0 {
+			h.transport.MaxIdleConnsPerHost = maxIdlePerHost
+		}
+		if maxPerHost > 0 {
+			h.transport.MaxConnsPerHost = maxPerHost
+		}
+		if idleTimeout > 0 {
+			h.transport.IdleConnTimeout = idleTimeout
+		}
+	}
+}
+
+// WithForceHTTP1 makes the default client speak HTTP/1.1 to https URLs when force is true,
+// disabling HTTP/2 it negotiates otherwise, e.g. for servers misbehaving with HTTP/2.
+func WithForceHTTP1(force bool) Option {
+	return func(h *ResponseSizeCounter) {
+		if force {
+			// a non-nil empty map leaves no protocol to upgrade a TLS connection to
+			h.transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+			h.transport.ForceAttemptHTTP2 = false
+
+			// a clone of the default transport inherits its TLS config offering HTTP/2 to servers
+			if h.transport.TLSClientConfig != nil {
+				protos := make([]string, 0, len(h.transport.TLSClientConfig.NextProtos))
+				for _, proto := range h.transport.TLSClientConfig.NextProtos {
+					if proto != "h2" {
+						protos = append(protos, proto)
+					}
+				}
+				h.transport.TLSClientConfig.NextProtos = protos
+			}
+		} else {
+			h.transport.TLSNextProto = nil
+			h.transport.ForceAttemptHTTP2 = true
+
+			// HTTP/2 is offered to servers once again, preferred the same as by the default transport
+			if h.transport.TLSClientConfig != nil {
+				protos := []string{"h2"}
+				for _, proto := range h.transport.TLSClientConfig.NextProtos {
+					if proto != "h2" {
+						protos = append(protos, proto)
+					}
+				}
+				h.transport.TLSClientConfig.NextProtos = protos
+			}
+		}
+	}
+}
+
+// WithSOCKS5Proxy makes the default client connect to hosts of URLs through a SOCKS5 proxy of a given address,
+// e.g. "127.0.0.1:1080" of an SSH tunnel or Tor, authenticating with a username and a password of auth, if any.
+//
+// Host names are resolved by the proxy. The proxy takes precedence over HTTP proxies set by the environment.
+// Connecting to the proxy is limited by the dial timeout, if set.
+func WithSOCKS5Proxy(addr string, auth *net_url.Userinfo) Option {
+	return func(h *ResponseSizeCounter) {
+		h.transport.Proxy = http.ProxyURL(&net_url.URL{Scheme: "socks5", Host: addr, User: auth})
+	}
+}
+
+// WithDialTimeout limits a time to establish a connection to a host of a URL, including DNS resolution.
+//
+// It has effect only on the default client of the handler. NewResponseSizeCounter fails if the timeout is negative.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.dialer.Timeout = timeout
+	}
+}
+
+// WithTLSHandshakeTimeout limits a time to perform a TLS handshake with a host of an https URL.
+//
+// It has effect only on the default client of the handler.
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.transport.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithFetchTimeout limits a time of fetching each URL, including reading its response body.
+//
+// Targets of a JSON request body are able to override the timeout with their 'timeout' field,
+// which is clamped to max unless it is not positive.
+func WithFetchTimeout(timeout, max time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.fetchTimeout = timeout
+		h.maxFetchTimeout = max
+	}
+}
+
+// WithRequestHook registers a function called with each outbound request after it is built and before it is sent,
+// e.g. to add tracing headers or to rewrite hosts. Hooks are called in the order they are registered.
+//
+// A hook must not replace the request context, the handler relies on it to cancel fetches and measure them.
+func WithRequestHook(hook func(req *http.Request)) Option {
+	return func(h *ResponseSizeCounter) {
+		h.requestHooks = append(h.requestHooks, hook)
+	}
+}
+
+// WithResponseHook registers a function called with each response before its body is read,
+// e.g. to collect metrics of statuses or headers. Hooks are called in the order they are registered.
+//
+// A hook must not read or close the response body, otherwise the reported size is wrong.
+func WithResponseHook(hook func(res *http.Response)) Option {
+	return func(h *ResponseSizeCounter) {
+		h.responseHooks = append(h.responseHooks, hook)
+	}
+}
+
+// WithRequestRecording makes results describe outbound requests performed to fetch their URLs:
+// a method, a URL and headers, so the requests are able to be replayed while debugging.
+//
+// Values of headers holding secrets, e.g. Authorization or X-Api-Key, and URL passwords are redacted.
+// Request bodies are not recorded.
+func WithRequestRecording() Option {
+	return func(h *ResponseSizeCounter) {
+		h.recordRequests = true
+	}
+}
+
+// WithConnectionTracing makes results report numbers of TCP connections opened and reused to fetch their URLs,
+// as connections_new and connections_reused, so keep-alive effectiveness is able to be checked.
+// A summary sums them up and sets them to X-Connections-New and X-Connections-Reused headers as well.
+func WithConnectionTracing() Option {
+	return func(h *ResponseSizeCounter) {
+		h.traceConnections = true
+	}
+}
+
+// WithDNSTiming enables measuring a time each fetch spends resolving hosts, reported in dns field of results
+// in JSON and NDJSON formats, so slow resolution is told apart from slow connecting and responding.
+//
+// Fetches reusing connections or fetching URLs of IP addresses resolve nothing, their DNS time is omitted.
+func WithDNSTiming() Option {
+	return func(h *ResponseSizeCounter) {
+		h.timeDNS = true
+	}
+}
+
+// WithTimings makes results report a waterfall of phases of fetching their URLs in timings field
+// in JSON and NDJSON formats: DNS lookups, connecting, TLS handshakes, waiting for the first byte
+// and transferring the body, which sum up to about the latency.
+//
+// It has effect only on clients reporting the phases with httptrace, as the default one does.
+func WithTimings() Option {
+	return func(h *ResponseSizeCounter) {
+		h.timings = true
+	}
+}
+
+// WithMaxBodySize limits a number of bytes read from each response body.
+//
+// A larger body is counted up to the limit and its result is marked as truncated,
+// along with the advertised Content-Length of the response, if any.
+func WithMaxBodySize(n int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxBodySize = n
+	}
+}
+
+// WithMaxContentLength fails fetches of URLs responding with a Content-Length larger than n
+// before their bodies are read.
+//
+// Counting a body never holds it in memory: it is streamed through a fixed-size buffer, so memory used
+// to count a single URL is bounded regardless of the body size, advertised or not. The option lets
+// adversarial or unexpectedly huge targets fail fast instead of being streamed through.
+func WithMaxContentLength(n int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxContentLength = n
+	}
+}
+
+// WithSizeGate skips URLs responding with a Content-Length larger than n without downloading their bodies,
+// their results are reported as skipped with "size" reason along with the advertised size.
+//
+// The size is learned from headers of the GET response itself, so no extra HEAD request is made.
+// Responses without Content-Length are counted as usual. Unlike WithMaxContentLength,
+// such URLs don't count as failed.
+func WithSizeGate(n int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.sizeGate = n
+	}
+}
+
+// WithManifest makes the handler return a manifest hash of results of each request when enabled,
+// a single fingerprint changing whenever a size of any URL does, in X-Manifest header
+// and in 'manifest' field of JSON output. See manifest for its canonical form.
+//
+// NDJSON results streamed as they complete have no manifest.
+func WithManifest(enabled bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.manifest = enabled
+	}
+}
+
+// WithShuffle makes the handler fetch URLs of a request in a random order when enabled,
+// so URLs of the same host submitted together don't make a hotspot. Results are still returned
+// in the order of submitted URLs.
+//
+// The order is seeded by the current time, unless WithShuffleSeed sets the seed.
+func WithShuffle(enabled bool) Option {
+	return func(h *ResponseSizeCounter) {
+		switch {
+		case !enabled:
+			h.shuffle = nil
+		case h.shuffle == nil:
+			h.shuffle = newShuffler(time.Now().UnixNano())
+		}
+	}
+}
+
+// WithShuffleSeed enables shuffling of an order URLs are fetched in, seeded with a given seed,
+// so the order is deterministic, e.g. in tests.
+func WithShuffleSeed(seed int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.shuffle = newShuffler(seed)
+	}
+}
+
+// WithWarmUp makes the handler fetch each URL n times before the measured fetch, discarding the results,
+// so caches along the way, e.g. of a CDN, are warm and the reported size and latency reflect a steady state.
+//
+// Each fetch is limited by the fetch timeout on its own.
+func WithWarmUp(n int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.warmUps = n
+	}
+}
+
+// WithRetries makes the handler repeat a fetch of a URL up to n times, pausing for delay before each repetition,
+// while it fails or is responded with a 5xx status.
+//
+// Each attempt is limited by the fetch timeout on its own. The result of the last attempt is reported
+// along with outcomes of all attempts, which are rendered in JSON and NDJSON formats.
+func WithRetries(n int, delay time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.retries = n
+		h.retryDelay = delay
+	}
+}
+
+// WithRetryBudget limits a total time of retrying a fetch of a URL, see WithRetries, so repetitions stop once
+// a time spent since the first attempt along with the delay before the next repetition reaches the budget,
+// even if there are repetitions left. A repetition still in progress when the budget runs out is cancelled.
+//
+// The first attempt is limited by the fetch timeout only, and every attempt is cancelled along with its request.
+func WithRetryBudget(budget time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.retryBudget = budget
+	}
+}
+
+// WithRetrySizePolicy sets which attempt of fetching a URL with retries reports its size, see WithRetries:
+// RetrySizeLast reports a size of the last attempt, which is the default,
+// RetrySizeFirst, RetrySizeMax and RetrySizeMin report the first, the largest and the smallest size
+// of successful attempts, so sizes of retried server error responses are never reported.
+//
+// A size of a URL failed by its last attempt is not replaced.
+func WithRetrySizePolicy(policy RetrySizePolicy) Option {
+	return func(h *ResponseSizeCounter) {
+		h.retrySizePolicy = policy
+	}
+}
+
+// WithResponseBodyHash enables computing a SHA-256 hash of each response body,
+// so clients are able to detect content changes between runs.
+//
+// A body is hashed in the same pass it is counted in.
+func WithResponseBodyHash() Option {
+	return func(h *ResponseSizeCounter) {
+		h.hashBodies = true
+	}
+}
+
+// WithMaxConcurrentFetches bounds a number of URLs fetched at the same time across all requests served by the handler.
+//
+// Fetches over the limit wait for running ones to finish. NewResponseSizeCounter fails if n is not positive.
+func WithMaxConcurrentFetches(n int) Option {
+	return func(h *ResponseSizeCounter) {
+		if n < 1 {
+			h.optionErrs = append(h.optionErrs, fmt.Errorf("%w: max concurrent fetches %d is not positive", errInvalidOption, n))
+			return
+		}
+		h.fetchSem = make(chan struct{}, n)
+	}
+}
+
+// WithAdaptiveConcurrency makes each request fetch up to max URLs at the same time when it is the only one served,
+// and fewer as more requests are served concurrently: max divided by a number of requests in flight, but at least min.
+//
+// WithMaxConcurrentFetches still bounds fetches of all requests.
+func WithAdaptiveConcurrency(min, max int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.adaptive = &adaptiveConcurrency{min: min, max: max}
+	}
+}
+
+// WithUnixSockets enables fetching URLs of http+unix scheme over Unix domain sockets of given paths,
+// e.g. http+unix://localhost/var/run/app.sock:/status. URLs of other sockets fail to be fetched.
+// NewResponseSizeCounter fails if no socket is given.
+//
+// Connections over sockets are configured the same as the rest of connections of the default client,
+// except they bypass proxies. It has effect only on the default client of the handler.
+func WithUnixSockets(sockets []string) Option {
+	return func(h *ResponseSizeCounter) {
+		if len(sockets) == 0 {
+			h.optionErrs = append(h.optionErrs, fmt.Errorf("%w: no unix sockets are allowed", errInvalidOption))
+			return
+		}
+
+		for _, socket := range sockets {
+			h.unixSockets = append(h.unixSockets, filepath.Clean(socket))
+		}
+	}
+}
+
+// WithLocalFiles enables measuring local files within a given root directory by file URLs,
+// e.g. file:///reports/daily.json measures a file reports/daily.json of the root.
+//
+// Paths are resolved against the root, so files outside of it, either by '..' or by symbolic links,
+// are not read. File URLs fail to be fetched unless the option is set, so do redirects to them anyway.
+// It has effect only on the default client of the handler.
+func WithLocalFiles(root string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.localFiles = newFileTransport(root)
+	}
+}
+
+// WithCommentPrefix makes the handler skip lines of a request body starting with a given prefix, e.g. "#".
+//
+// Comments are not recognized by default.
+func WithCommentPrefix(prefix string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.commentPrefix = prefix
+	}
+}
+
+// WithNamedList registers a list of URLs requests are able to refer to with 'list' query parameter.
+//
+// URLs of a request body, if any, are measured along with the named list.
+func WithNamedList(name string, urls []string) Option {
+	return func(h *ResponseSizeCounter) {
+		if h.namedLists == nil {
+			h.namedLists = make(map[string][]string)
+		}
+		h.namedLists[name] = append([]string(nil), urls...)
+	}
+}
+
+// WithForwardedHeaders makes the handler copy headers of given names from an incoming request
+// to each outbound request it performs, e.g. "Cookie" or "X-Request-Id".
+//
+// Every value of a multi-valued header is copied.
+func WithForwardedHeaders(names ...string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.forwardHeaders = append(h.forwardHeaders, names...)
+	}
+}
+
+// WithCookieJar makes outbound requests of each incoming request share a cookie jar when enabled,
+// so a cookie set by a response to one URL, e.g. of a login page, is sent with requests of URLs fetched after it.
+// Jars are never shared between incoming requests.
+//
+// URLs are fetched concurrently, so a URL depending on a cookie of another one needs them fetched one by one,
+// see WithMaxConcurrentFetches. Cookies set by redirect responses of the default client are not stored.
+func WithCookieJar(enabled bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.cookieJar = enabled
+	}
+}
+
+// WithAcceptHeader sets Accept header of outbound requests, e.g. "application/json",
+// so sizes of content-negotiating URLs are reproducible.
+func WithAcceptHeader(accept string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.accept = accept
+	}
+}
+
+// WithRedirectSizeMode sets which responses of a followed redirect chain count toward a reported size:
+// RedirectSizeFinal counts only the final response body, which is the default,
+// RedirectSizeSum adds bodies of intermediate redirect responses to it.
+//
+// It has effect only on the default client of the handler.
+func WithRedirectSizeMode(mode RedirectSizeMode) Option {
+	return func(h *ResponseSizeCounter) {
+		h.redirectSizeMode = mode
+	}
+}
+
+// WithSchemeDowngradeMode sets how redirects from https to http URLs are handled:
+// SchemeDowngradeFollow follows them as any other ones, which is the default,
+// SchemeDowngradeFlag follows them setting scheme_downgrade of results,
+// SchemeDowngradeBlock fails fetches with "scheme downgrade" error.
+//
+// It has effect only on the default client of the handler.
+func WithSchemeDowngradeMode(mode SchemeDowngradeMode) Option {
+	return func(h *ResponseSizeCounter) {
+		h.schemeDowngradeMode = mode
+	}
+}
+
+// WithMaxRedirects sets a number of redirects followed before a fetch fails with "too many redirects" error,
+// 10 by default. Zero makes every redirect fail.
+//
+// It has effect only on the default client of the handler.
+func WithMaxRedirects(n int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxRedirects = n
+	}
+}
+
+// WithContentTypes makes the handler count only responses having a content type starting with one of given prefixes,
+// e.g. "image/" or "application/javascript". Prefixes are matched case-insensitively.
+//
+// Other responses are reported as skipped with "type" reason, their bodies are not read.
+func WithContentTypes(prefixes ...string) Option {
+	return func(h *ResponseSizeCounter) {
+		for _, prefix := range prefixes {
+			h.contentTypes = append(h.contentTypes, strings.ToLower(prefix))
+		}
+	}
+}
+
+// WithListSources enables requests with 'source' query parameter set to true to submit a single URL
+// the handler fetches a list of URLs separated by a new line from, up to maxSize bytes.
+//
+// Sources connecting to loopback, private and link-local addresses, literal or resolved ones,
+// are rejected with 403 status, along with non-http(s) ones and ones out of the allowed hosts.
+// The default client checks an address it connects to, which is an address of a proxy if one is used.
+func WithListSources(maxSize int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxSourceSize = maxSize
+	}
+}
+
+// WithAllowedHosts restricts hosts of URLs the handler fetches to given ones.
+// A host may be a wildcard like *.example.com matching any subdomain of example.com, but not example.com itself.
+// Hosts are matched case-insensitively regardless of ports.
+//
+// Requests submitting a URL of another host are rejected with 403 status before fetching anything,
+// redirects to other hosts fail the fetch.
+func WithAllowedHosts(hosts []string) Option {
+	return func(h *ResponseSizeCounter) {
+		for _, host := range hosts {
+			h.allowedHosts = append(h.allowedHosts, strings.ToLower(host))
+		}
+	}
+}
+
+// WithCircuitBreaker stops fetching URLs of a host for a cooldown after a threshold of consecutive failures,
+// the URLs are reported as skipped with "circuit open" reason.
+//
+// After the cooldown a single URL of the host is fetched as a probe:
+// the host is fetched as usual again if it succeeds, otherwise it is skipped for one more cooldown.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithTrimSpace sets whether whitespaces surrounding lines of a request body are trimmed before validating URLs.
+//
+// Lines are trimmed by default, strict users may disable it to reject such lines instead.
+// Whitespaces within a URL make it invalid in any case.
+func WithTrimSpace(trim bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.keepSpace = !trim
+	}
+}
+
+// WithStrictLines makes blank lines of a request body invalid, so requests having them are rejected
+// with 400 status naming the lines, the same as lines which are not URLs.
+//
+// Blank lines are skipped by default. A line of whitespaces only is blank unless whitespaces are kept.
+func WithStrictLines(strict bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.strictLines = strict
+	}
+}
+
+// WithMaxRequestSize limits a size of a request body to n bytes, so larger requests are rejected with 413 status.
+//
+// A body compressed with gzip, as told by its Content-Encoding header, is decompressed as it is read
+// and the limit applies to the decompressed body, which is limited to 64 MiB unless the limit is set.
+func WithMaxRequestSize(n int64) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxRequestSize = n
+	}
+}
+
+// WithMaxLineLength limits a length of a line of a request body to n bytes, 64 KiB by default,
+// so requests having a longer line are rejected with 400 status naming the line.
+func WithMaxLineLength(n int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.maxLineLength = n
+	}
+}
+
+// WithDiskSpill makes the handler write results to a temporary file in a given directory as URLs are fetched
+// and read them back while rendering a response, so huge batches don't have to be held in memory.
+// The default directory for temporary files is used if dir is empty.
+//
+// The file is removed once a response is written. Results are still returned in the order of submitted URLs.
+// Requests selecting the slowest results are not spilled as they need all the results to be sorted.
+func WithDiskSpill(dir string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.spill = true
+		h.spillDir = dir
+	}
+}
+
+// WithExportDir allows requests to export results to a CSV file within a given directory
+// by naming the file with 'export' query parameter, e.g. '?export=daily.csv'. Such a request is responded
+// with a JSON object holding a path of the file and a number of exported results instead of the results.
+//
+// The name must be a plain file name of a file not existing yet, so exports neither escape the directory
+// nor overwrite each other. Requests naming an existing file are rejected with 409 status.
+func WithExportDir(dir string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.exportDir = dir
+	}
+}
+
+// WithFailFastOnStatus makes the handler stop fetching URLs of a request once one of them is responded
+// with a non-2xx status when enabled, cancelling fetches in progress and skipping the rest.
+// Only results of URLs fetched till then, the one responded so included, are returned.
+//
+// URLs failing to respond at all, e.g. because of connection errors, don't stop fetching.
+// Results are neither streamed nor spilled to disk if it is enabled.
+func WithFailFastOnStatus(enabled bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.failFastOnStatus = enabled
+	}
+}
+
+// WithAllFailedStatus sets a response status used when every fetched URL fails, 502 Bad Gateway by default.
+//
+// A response is still rendered with the results, so the client is able to see why the URLs failed.
+// Responses streamed as NDJSON are not affected as their status is sent before any URL is fetched.
+func WithAllFailedStatus(status int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.allFailedStatus = status
+	}
+}
+
+// WithSort sets an order of results within a response, so responses are able to be diffed across runs.
+// Results are in the order their URLs are fetched in by default.
+//
+// Sorted results are rendered once every URL is fetched, so NDJSON responses are not streamed
+// and results are not spilled to disk.
+func WithSort(order SortOrder) Option {
+	return func(h *ResponseSizeCounter) {
+		h.sort = order
+	}
+}
+
+// WithMismatchStatus sets a response status used when a URL responds with a size other than
+// the one its target of a JSON request body expects with 'expect' field, e.g. 409 Conflict.
+// The response status is not affected by mismatches by default.
+//
+// The status used when every URL fails takes precedence. Streamed responses are not affected.
+func WithMismatchStatus(status int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.mismatchStatus = status
+	}
+}
+
+// WithFields sets fields of results rendered in CSV and JSON formats and their order, e.g. "url", "status", "size",
+// unless a request selects others with 'fields' query parameter. All fields are rendered by default.
+//
+// Known fields are url, size, status, latency, ttfb, dns, error, error_class, skipped, hash, proto and truncated.
+// NewResponseSizeCounter fails if a field is unknown or given more than once.
+func WithFields(names ...string) Option {
+	return func(h *ResponseSizeCounter) {
+		fl, err := parseFields(names)
+		if err != nil {
+			h.optionErrs = append(h.optionErrs, fmt.Errorf("%w: fields: %w", errInvalidOption, err))
+			return
+		}
+		h.fields = fl
+	}
+}
+
+// WithMetricsEndpoint makes MakeResponseSizeCounter serve counters of requests and fetched URLs
+// at GET /metrics in the Prometheus text exposition format, bypassing the rate limit.
+//
+// The counters are collected regardless, they are available with MetricsHandler as well.
+func WithMetricsEndpoint(enabled bool) Option {
+	return func(h *ResponseSizeCounter) {
+		h.metricsEndpoint = enabled
+	}
+}
+
+// WithRateLimitReset makes MakeResponseSizeCounter serve POST /admin/rate-limit/reset, which clears
+// rate limit counters of all IPs at once, e.g. after a configuration change, instead of waiting for the window.
+//
+// The endpoint requires HTTP basic authentication with one of given username to password pairs
+// and bypasses the rate limit, so it is reachable even by an operator who exceeded it.
+func WithRateLimitReset(credentials map[string]string) Option {
+	return func(h *ResponseSizeCounter) {
+		h.adminCredentials = credentials
+	}
+}
+
+// WithStreamBuffer sets a number of results waiting to be streamed to a client.
+//
+// When the client reads slower than URLs are fetched, fetching is paused until the buffer has room.
+func WithStreamBuffer(n int) Option {
+	return func(h *ResponseSizeCounter) {
+		h.streamBuffer = n
+	}
+}
+
+// WithStreamIdleTimeout disconnects a client of a streamed response, either NDJSON or WebSocket one,
+// when a result is not written to it within a given timeout, e.g. as the client stopped reading.
+// Remaining fetches are cancelled then, the same as when the client goes away.
+//
+// Only writing is limited, so results which take long to fetch don't make the stream idle.
+func WithStreamIdleTimeout(timeout time.Duration) Option {
+	return func(h *ResponseSizeCounter) {
+		h.streamIdleTimeout = timeout
+	}
+}
@@ -0,0 +1,1349 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithMaxHeaderBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/large" {
+			w.Header().Set("X-Large", strings.Repeat("0", 4*1024))
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithMaxHeaderBytes(1024))
+
+	if _, err := handler.do(context.Background(), target{URL: srv.URL + "/large"}); err == nil {
+		t.Error("over-limit response headers handled incorrectly")
+	}
+
+	result, err := handler.do(context.Background(), target{URL: srv.URL + "/small"})
+	if err != nil {
+		t.Errorf("cannot get response within headers limit: %s", err)
+	}
+
+	if result.Size != 4 {
+		t.Errorf("wrong response size: want = %d, got = %d", 4, result.Size)
+	}
+}
+
+func TestWithDialTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	handler := newResponseSizeCounter(t, WithDialTimeout(timeout))
+
+	// 10.255.255.1 is not routable, so a connection to it is never established
+	start := time.Now()
+	if _, err := handler.do(context.Background(), target{URL: "http://10.255.255.1:81"}); err == nil {
+		t.Error("connection to unreachable host established")
+	}
+
+	if elapsed := time.Since(start); elapsed > 20*timeout {
+		t.Errorf("dial timeout did not fire: want about %s, got = %s", timeout, elapsed)
+	}
+}
+
+func TestWithDisableKeepAlives(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		var accepted int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte("body"))
+		}))
+		srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}
+		srv.Start()
+
+		handler := newResponseSizeCounter(t, WithDisableKeepAlives(disable), WithConnectionTracing())
+
+		for i := 0; i < 3; i++ {
+			result, err := handler.do(context.Background(), target{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("cannot get response: %s", err)
+			}
+
+			// the first fetch opens a connection in any case
+			if reused := result.Reused > 0; i > 0 && reused == disable {
+				t.Errorf("disabled keep-alives = %t: wrong connection reuse of fetch #%d: %+v", disable, i, result.ConnectionCounts)
+			}
+		}
+
+		srv.Close()
+
+		want := int32(1)
+		if disable {
+			want = 3
+		}
+		if got := atomic.LoadInt32(&accepted); got != want {
+			t.Errorf("disabled keep-alives = %t: wrong number of connections: want = %d, got = %d", disable, want, got)
+		}
+	}
+}
+
+func TestWithConnectionPool(t *testing.T) {
+	var accepted int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&accepted, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithConnectionPool(10, 2, 2, time.Minute))
+
+	urls := make([]string, 0, 4)
+	for i := 0; i < 4; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", srv.URL, i))
+	}
+
+	// requests fetching the same host share connections of the pool
+	for i := 0; i < 3; i++ {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{},
+			Body:   io.NopCloser(strings.NewReader(strings.Join(urls, "\n"))),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong status of request #%d: want = %d, got = %d", i, http.StatusOK, w.Code)
+		}
+	}
+
+	if got := atomic.LoadInt32(&accepted); got < 1 || got > 2 {
+		t.Errorf("wrong number of connections: want at most %d, got = %d", 2, got)
+	}
+}
+
+func TestWithForceHTTP1(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	// the server speaks both protocols, so a client chooses one
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		proto string
+	}{
+		{name: "default", opts: []Option{WithCABundle(certPEM(srv))}, proto: "HTTP/2.0"},
+		{name: "forced", opts: []Option{WithCABundle(certPEM(srv)), WithForceHTTP1(true)}, proto: "HTTP/1.1"},
+		{name: "not forced", opts: []Option{WithCABundle(certPEM(srv)), WithForceHTTP1(true), WithForceHTTP1(false)}, proto: "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+
+		result, err := handler.do(context.Background(), target{URL: srv.URL})
+		if err != nil {
+			t.Fatalf("%s: cannot get response: %s", tt.name, err)
+		}
+
+		if result.Proto != tt.proto {
+			t.Errorf("%s: wrong protocol: want = %s, got = %s", tt.name, tt.proto, result.Proto)
+		}
+	}
+}
+
+func TestWithForceHTTP1_toggled(t *testing.T) {
+	handler := newResponseSizeCounter(t, WithForceHTTP1(true), WithForceHTTP1(false))
+
+	config := handler.transport.TLSClientConfig
+	if config == nil || len(config.NextProtos) == 0 || config.NextProtos[0] != "h2" {
+		t.Errorf("HTTP/2 is not offered once HTTP/1.1 is not forced: %+v", config)
+	}
+	if handler.transport.TLSNextProto != nil || !handler.transport.ForceAttemptHTTP2 {
+		t.Error("HTTP/2 is not enabled once HTTP/1.1 is not forced")
+	}
+}
+
+func TestWithSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	proxy := newSOCKS5Stub(t, "user", "secret")
+	defer func() { _ = proxy.ln.Close() }()
+
+	handler := newResponseSizeCounter(t, WithSOCKS5Proxy(proxy.ln.Addr().String(), net_url.UserPassword("user", "secret")))
+
+	result, err := handler.do(context.Background(), target{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("cannot get response through proxy: %s", err)
+	}
+
+	if result.Size != 4 {
+		t.Errorf("wrong response size: want = %d, got = %d", 4, result.Size)
+	}
+
+	if got := proxy.connected(); len(got) != 1 || got[0] != srv.Listener.Addr().String() {
+		t.Errorf("wrong proxied connections: want = [%s], got = %v", srv.Listener.Addr(), got)
+	}
+
+	handler = newResponseSizeCounter(t, WithSOCKS5Proxy(proxy.ln.Addr().String(), net_url.UserPassword("user", "wrong")))
+
+	if _, err := handler.do(context.Background(), target{URL: srv.URL}); err == nil {
+		t.Error("connection through proxy is established with wrong credentials")
+	}
+}
+
+// socks5Stub is a SOCKS5 proxy supporting CONNECT command with username and password authentication.
+type socks5Stub struct {
+	ln                 net.Listener
+	username, password string
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func newSOCKS5Stub(t *testing.T, username, password string) *socks5Stub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+
+	s := &socks5Stub{ln: ln, username: username, password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *socks5Stub) connected() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.targets...)
+}
+
+func (s *socks5Stub) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	// greeting: version, methods
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, head[1])); err != nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 2})
+
+	// username and password authentication, see RFC 1929
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	username := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, head[:1]); err != nil {
+		return
+	}
+	password := make([]byte, head[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return
+	}
+	if string(username) != s.username || string(password) != s.password {
+		_, _ = conn.Write([]byte{1, 1})
+		return
+	}
+	_, _ = conn.Write([]byte{1, 0})
+
+	// request: version, command, reserved, address type, address, port
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		if _, err := io.ReadFull(conn, head[:1]); err != nil {
+			return
+		}
+		name := make([]byte, head[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+
+	upstream, err := net.Dial("tcp", addr)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	s.mu.Lock()
+	s.targets = append(s.targets, addr)
+	s.mu.Unlock()
+
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestWithTLSHandshakeTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	// the listener accepts connections but never responds to a TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	handler := newResponseSizeCounter(t, WithTLSHandshakeTimeout(timeout))
+
+	start := time.Now()
+	_, err = handler.do(context.Background(), target{URL: "https://" + ln.Addr().String()})
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake timeout") {
+		t.Errorf("wrong error: want TLS handshake timeout, got = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 20*timeout {
+		t.Errorf("TLS handshake timeout did not fire: want about %s, got = %s", timeout, elapsed)
+	}
+}
+
+func TestWithMaxBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		size := 1000
+		if req.URL.Path == "/small" {
+			size = 100
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		_, _ = w.Write([]byte(strings.Repeat("0", size)))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithMaxBodySize(100))
+
+	result, err := handler.do(context.Background(), target{URL: srv.URL + "/large"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if !result.Truncated || result.Size != 100 || result.AdvertisedSize != 1000 {
+		t.Errorf("large body is not truncated: %+v", result)
+	}
+
+	result, err = handler.do(context.Background(), target{URL: srv.URL + "/small"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if result.Truncated || result.Size != 100 || result.AdvertisedSize != 0 {
+		t.Errorf("body within limit is truncated: %+v", result)
+	}
+}
+
+func TestWithMaxContentLength(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	res := hugeResponse(1 << 30)
+	res.ContentLength = 1 << 30
+	res.Body = io.NopCloser(readerFunc(func([]byte) (int, error) {
+		t.Error("body of response exceeding maximum content length is read")
+		return 0, io.EOF
+	}))
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://huge.com")).Return(res, nil)
+	client.EXPECT().Do(requestTo("https://small.com")).Return(&http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: 4,
+		Body:          io.NopCloser(strings.NewReader("body")),
+	}, nil)
+
+	handler := newResponseSizeCounter(t, WithMaxContentLength(1<<20))
+	handler.SetClient(client)
+
+	if _, err := handler.do(context.Background(), target{URL: "https://huge.com"}); err == nil {
+		t.Error("response exceeding maximum content length is counted")
+	}
+
+	result, err := handler.do(context.Background(), target{URL: "https://small.com"})
+	if err != nil {
+		t.Fatalf("cannot get response within maximum content length: %s", err)
+	}
+
+	if result.Size != 4 {
+		t.Errorf("wrong response size: want = %d, got = %d", 4, result.Size)
+	}
+}
+
+func TestWithSizeGate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://huge.com")).Return(&http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: 1 << 30,
+		Body: io.NopCloser(readerFunc(func([]byte) (int, error) {
+			t.Error("body of response over the size gate is downloaded")
+			return 0, io.EOF
+		})),
+	}, nil)
+	client.EXPECT().Do(requestTo("https://small.com")).Return(&http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: 4,
+		Body:          io.NopCloser(strings.NewReader("body")),
+	}, nil)
+	client.EXPECT().Do(requestTo("https://chunked.com")).Return(&http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: -1,
+		Body:          io.NopCloser(strings.NewReader(strings.Repeat("0", 2048))),
+	}, nil)
+
+	handler := newResponseSizeCounter(t, WithSizeGate(1024))
+	handler.SetClient(client)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{"Accept": []string{"application/json"}},
+		Body:   io.NopCloser(strings.NewReader("https://huge.com\nhttps://small.com\nhttps://chunked.com")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("results count: want = %d, got = %d", 3, len(results))
+	}
+
+	if res := results[0]; res.Skipped != skippedBySize || res.AdvertisedSize != 1<<30 || res.Size != 0 || res.Error != "" {
+		t.Errorf("response over the size gate is not skipped: %+v", res)
+	}
+	if res := results[1]; res.Skipped != "" || res.Size != 4 {
+		t.Errorf("response within the size gate is not counted: %+v", res)
+	}
+	// a size is not advertised, so the body is counted
+	if res := results[2]; res.Skipped != "" || res.Size != 2048 {
+		t.Errorf("response without content length is not counted: %+v", res)
+	}
+}
+
+// readerFunc is an io.Reader calling itself.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestWithWarmUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	calls := 0
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://test-1.com")).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		calls++
+
+		// a cache miss responds with a larger body
+		size := 100
+		if calls == 1 {
+			size = 1000
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(strings.Repeat("0", size))),
+		}, nil
+	}).Times(3)
+
+	handler := newResponseSizeCounter(t, WithWarmUp(2))
+	handler.SetClient(client)
+
+	result, err := handler.fetch(context.Background(), target{URL: "https://test-1.com"}, params{})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if result.Size != 100 {
+		t.Errorf("wrong steady-state size: want = %d, got = %d", 100, result.Size)
+	}
+}
+
+func TestWithResponseBodyHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-1.com")).Return(&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("hello, world")),
+		}, nil)
+	}
+
+	handler := newResponseSizeCounter(t, WithResponseBodyHash())
+	handler.client = client
+
+	result, err := handler.do(context.Background(), target{URL: "https://test-1.com"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	want := "09ca7e4eaa6e8ae9c7d261167129184883644d07dfba7cbfbc4c8a2e08360d5b"
+	if result.Hash != want {
+		t.Errorf("wrong response body hash: want = %s, got = %s", want, result.Hash)
+	}
+
+	if result.Size != 12 {
+		t.Errorf("wrong response size: want = %d, got = %d", 12, result.Size)
+	}
+}
+
+func TestWithMaxConcurrentFetches(t *testing.T) {
+	const (
+		maxFetches = 2
+		requests   = 3
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var current, peak int32
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+			n := atomic.AddInt32(&current, 1)
+			defer atomic.AddInt32(&current, -1)
+
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			return response(http.StatusOK), nil
+		}).Times(3 * requests)
+	}
+
+	handler := newResponseSizeCounter(t, WithMaxConcurrentFetches(maxFetches))
+	handler.client = client
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request())
+
+			if res := w.Result(); res.StatusCode != http.StatusOK {
+				t.Errorf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if peak != maxFetches {
+		t.Errorf("concurrent fetches: want = %d, got = %d", maxFetches, peak)
+	}
+}
+
+func TestWithCommentPrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-2.com")).Return(response(http.StatusOK), nil)
+	}
+
+	handler := newResponseSizeCounter(t, WithCommentPrefix("#"))
+	handler.client = client
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		Body:   io.NopCloser(strings.NewReader("# test-1 is down\n#https://test-1.com\n\nhttps://test-2.com\n")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+}
+
+func TestWithNamedList(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		body   string
+		status int
+		urls   []string
+	}{
+		{
+			name:   "named list",
+			query:  "list=cdn",
+			status: http.StatusOK,
+			urls:   []string{"https://cdn-1.com", "https://cdn-2.com"},
+		},
+		{
+			name:   "merged with body",
+			query:  "list=cdn",
+			body:   "https://test-1.com",
+			status: http.StatusOK,
+			urls:   []string{"https://cdn-1.com", "https://cdn-2.com", "https://test-1.com"},
+		},
+		{
+			name:   "unknown list",
+			query:  "list=origin",
+			body:   "https://test-1.com",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			for _, url := range tt.urls {
+				client.EXPECT().Do(requestTo(url)).Return(response(http.StatusOK), nil)
+			}
+
+			handler := newResponseSizeCounter(t, WithNamedList("cdn", []string{"https://cdn-1.com", "https://cdn-2.com"}))
+			handler.client = client
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &net_url.URL{RawQuery: tt.query + "&echo=true"},
+				Body:   io.NopCloser(strings.NewReader(tt.body)),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			res := w.Result()
+			if res.StatusCode != tt.status {
+				t.Fatalf("wrong response status: want = %d, got = %d", tt.status, res.StatusCode)
+			}
+			defer closeResBody(res.Body)
+
+			if got := res.Header.Values(effectiveURLHeader); strings.Join(got, " ") != strings.Join(tt.urls, " ") {
+				t.Errorf("wrong effective urls: want = %v, got = %v", tt.urls, got)
+			}
+		})
+	}
+}
+
+func TestWithMaxRedirects(t *testing.T) {
+	// /N redirects N times before responding
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/"))
+		if n > 0 {
+			http.Redirect(w, req, "/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		redirects int
+		fail      bool
+	}{
+		{name: "default", redirects: 10},
+		{name: "default exceeded", redirects: 11, fail: true},
+		{name: "zero, no redirects", opts: []Option{WithMaxRedirects(0)}, redirects: 0},
+		{name: "zero", opts: []Option{WithMaxRedirects(0)}, redirects: 1, fail: true},
+		{name: "two", opts: []Option{WithMaxRedirects(2)}, redirects: 2},
+		{name: "two exceeded", opts: []Option{WithMaxRedirects(2)}, redirects: 3, fail: true},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+
+		result, err := handler.do(context.Background(), target{URL: srv.URL + "/" + strconv.Itoa(tt.redirects)})
+		if tt.fail {
+			if err == nil || !strings.Contains(err.Error(), "too many redirects") {
+				t.Errorf("%s: wrong error: want too many redirects, got = %v", tt.name, err)
+			}
+			continue
+		}
+
+		if err != nil || result.Size != 4 {
+			t.Errorf("%s: redirects are not followed: %+v, %v", tt.name, result, err)
+		}
+	}
+}
+
+func TestWithAcceptHeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://test-1.com")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		body := "<html><body>negotiated</body></html>"
+		if req.Header.Get("Accept") == "application/json" {
+			body = `{"negotiated": true}`
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}).Times(2)
+
+	tests := []struct {
+		opts []Option
+		want int
+	}{
+		{want: len("<html><body>negotiated</body></html>")},
+		{opts: []Option{WithAcceptHeader("application/json")}, want: len(`{"negotiated": true}`)},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+		handler.SetClient(client)
+
+		result, err := handler.do(context.Background(), target{URL: "https://test-1.com"})
+		if err != nil {
+			t.Fatalf("cannot get response: %s", err)
+		}
+
+		if result.Size != tt.want {
+			t.Errorf("wrong size with %d options: want = %d, got = %d", len(tt.opts), tt.want, result.Size)
+		}
+	}
+}
+
+func TestWithRequestHook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://mirror.test-1.com/a")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		if got := req.Header.Get("X-Trace-Id"); got != "42" {
+			t.Errorf("wrong X-Trace-Id header: want = %s, got = %s", "42", got)
+		}
+
+		return response(http.StatusOK), nil
+	})
+
+	handler := newResponseSizeCounter(t,
+		WithRequestHook(func(req *http.Request) {
+			req.URL.Host = "mirror." + req.URL.Host
+		}),
+		WithRequestHook(func(req *http.Request) {
+			req.Header.Set("X-Trace-Id", "42")
+		}),
+	)
+	handler.SetClient(client)
+
+	result, err := handler.do(context.Background(), target{URL: "https://test-1.com/a"})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if result.URL != "https://test-1.com/a" {
+		t.Errorf("wrong result URL: want = %s, got = %s", "https://test-1.com/a", result.URL)
+	}
+}
+
+func TestWithResponseHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	var status int
+	var cache string
+
+	handler := newResponseSizeCounter(t, WithResponseHook(func(res *http.Response) {
+		status = res.StatusCode
+		cache = res.Header.Get("X-Cache")
+	}))
+
+	result, err := handler.do(context.Background(), target{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("cannot get response: %s", err)
+	}
+
+	if status != http.StatusAccepted || cache != "HIT" {
+		t.Errorf("hook saw wrong response: status = %d, X-Cache = %s", status, cache)
+	}
+
+	if result.Size != 4 {
+		t.Errorf("wrong size: want = %d, got = %d", 4, result.Size)
+	}
+}
+
+func TestWithRedirectSizeMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/first":
+			w.Header().Set("Location", "/second")
+			w.WriteHeader(http.StatusFound)
+			_, _ = w.Write([]byte(strings.Repeat("0", 100)))
+		case "/second":
+			w.Header().Set("Location", "/final")
+			w.WriteHeader(http.StatusFound)
+			_, _ = w.Write([]byte(strings.Repeat("0", 200)))
+		default:
+			_, _ = w.Write([]byte(strings.Repeat("0", 1000)))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{name: "default", want: 1000},
+		{name: "final", opts: []Option{WithRedirectSizeMode(RedirectSizeFinal)}, want: 1000},
+		{name: "sum", opts: []Option{WithRedirectSizeMode(RedirectSizeSum)}, want: 1300},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+
+		result, err := handler.do(context.Background(), target{URL: srv.URL + "/first"})
+		if err != nil {
+			t.Fatalf("%s: cannot get response: %s", tt.name, err)
+		}
+
+		if result.Size != tt.want {
+			t.Errorf("%s: wrong size: want = %d, got = %d", tt.name, tt.want, result.Size)
+		}
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithSchemeDowngradeMode(t *testing.T) {
+	// https://secure.com redirects to its plain http counterpart
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Scheme == "https" {
+			return &http.Response{
+				StatusCode: http.StatusFound,
+				Header:     http.Header{"Location": {"http://secure.com/"}},
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("body")),
+			Request:    req,
+		}, nil
+	})
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		downgraded bool
+		blocked    bool
+	}{
+		{name: "default"},
+		{name: "follow", opts: []Option{WithSchemeDowngradeMode(SchemeDowngradeFollow)}},
+		{name: "flag", opts: []Option{WithSchemeDowngradeMode(SchemeDowngradeFlag)}, downgraded: true},
+		{name: "block", opts: []Option{WithSchemeDowngradeMode(SchemeDowngradeBlock)}, blocked: true},
+	}
+
+	for _, tt := range tests {
+		handler := newResponseSizeCounter(t, tt.opts...)
+		handler.client.(*http.Client).Transport = transport
+
+		result, err := handler.do(context.Background(), target{URL: "https://secure.com/"})
+		if tt.blocked {
+			if !errors.Is(err, errSchemeDowngrade) {
+				t.Errorf("%s: wrong error: want = %s, got = %v", tt.name, errSchemeDowngrade, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: cannot get response: %s", tt.name, err)
+		}
+
+		if result.SchemeDowngrade != tt.downgraded || result.Size != 4 {
+			t.Errorf("%s: wrong result: want downgraded = %t and size = %d, got = %+v", tt.name, tt.downgraded, 4, result)
+		}
+	}
+}
+
+func TestWithFailFastOnStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// a connection error doesn't stop fetching, a server error does, so the last URLs are never fetched
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+	client.EXPECT().Do(requestTo("https://test-2.com")).Return(nil, errors.New("connection refused"))
+	client.EXPECT().Do(requestTo("https://test-3.com")).Return(response(http.StatusInternalServerError), nil)
+
+	// fetches one by one start in the order of URLs
+	handler := newResponseSizeCounter(t, WithFailFastOnStatus(true), WithMaxConcurrentFetches(1))
+	handler.SetClient(client)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "format=json"},
+		Body:   io.NopCloser(strings.NewReader("https://test-1.com\nhttps://test-2.com\nhttps://test-3.com\nhttps://test-4.com\nhttps://test-5.com")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	urls := make([]string, 0, len(results))
+	for _, res := range results {
+		urls = append(urls, res.URL)
+	}
+
+	want := []string{"https://test-1.com", "https://test-2.com", "https://test-3.com"}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Errorf("wrong fetched URLs: want = %v, got = %v", want, urls)
+	}
+}
+
+func TestWithContentTypes(t *testing.T) {
+	types := map[string]string{
+		"/logo":   "image/png",
+		"/photo":  "IMAGE/jpeg",
+		"/page":   "text/html; charset=utf-8",
+		"/script": "application/javascript",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", types[req.URL.Path])
+		_, _ = w.Write([]byte(strings.Repeat("0", 1000)))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithContentTypes("image/"))
+
+	for path, contentType := range types {
+		result, err := handler.do(context.Background(), target{URL: srv.URL + path})
+		if err != nil {
+			t.Fatalf("cannot get response of %s: %s", path, err)
+		}
+
+		if strings.HasPrefix(strings.ToLower(contentType), "image/") {
+			if result.Skipped != "" || result.Size != 1000 {
+				t.Errorf("%s response is not counted: %+v", contentType, result)
+			}
+		} else {
+			if result.Skipped != skippedByType || result.Size != 0 {
+				t.Errorf("%s response is not skipped: %+v", contentType, result)
+			}
+		}
+	}
+}
+
+func TestWithAllowedHosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "exact", body: "https://example.com\nhttps://EXAMPLE.com:8443/page", status: http.StatusOK},
+		{name: "wildcard", body: "https://cdn.example.org\nhttps://img.cdn.example.org", status: http.StatusOK},
+		{name: "disallowed", body: "https://example.com\nhttps://evil.com", status: http.StatusForbidden},
+		{name: "wildcard apex", body: "https://example.org", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			if tt.status == http.StatusOK {
+				client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+					return response(http.StatusOK), nil
+				}).Times(2)
+			}
+
+			handler := newResponseSizeCounter(t, WithAllowedHosts([]string{"example.com", "*.example.org"}))
+			handler.SetClient(client)
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(tt.body)),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("wrong response status: want = %d, got = %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestWithAllowedHosts_redirect(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer other.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithAllowedHosts([]string{"127.0.0.1"}))
+
+	if _, err := handler.do(context.Background(), target{URL: srv.URL}); err == nil || !strings.Contains(err.Error(), errHostNotAllowed.Error()) {
+		t.Errorf("redirect to disallowed host is followed: %v", err)
+	}
+}
+
+func TestWithSort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		// URLs later in the alphabet complete first
+		time.Sleep(time.Duration('z'-req.URL.Host[0]) * time.Millisecond)
+		return response(http.StatusOK), nil
+	}).Times(8)
+
+	handler := newResponseSizeCounter(t, WithSort(SortByURL))
+	handler.SetClient(client)
+
+	want := []string{"https://a.com", "https://a.com", "https://b.com", "https://c.com"}
+
+	for _, accept := range []string{"application/json", "application/x-ndjson"} {
+		req := &http.Request{
+			Method: http.MethodPost,
+			Header: http.Header{"Accept": []string{accept}},
+			Body:   io.NopCloser(strings.NewReader("https://c.com\nhttps://a.com\nhttps://b.com\nhttps://a.com")),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		var results []Result
+		dec := json.NewDecoder(w.Body)
+		if accept == "application/json" {
+			if err := dec.Decode(&results); err != nil {
+				t.Fatalf("%s: cannot decode response body: %s", accept, err)
+			}
+		} else {
+			for dec.More() {
+				var res Result
+				if err := dec.Decode(&res); err != nil {
+					t.Fatalf("%s: cannot decode response body: %s", accept, err)
+				}
+				results = append(results, res)
+			}
+		}
+
+		urls := make([]string, 0, len(results))
+		for _, res := range results {
+			urls = append(urls, res.URL)
+		}
+
+		if strings.Join(urls, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: wrong order: want = %v, got = %v", accept, want, urls)
+		}
+	}
+}
+
+func TestSortResults_duplicates(t *testing.T) {
+	results := []Result{
+		{URL: "https://b.com", order: 0},
+		{URL: "https://a.com", order: 3, Size: 3},
+		{URL: "https://a.com", order: 1, Size: 1},
+		{URL: "https://a.com", order: 2, Size: 2},
+	}
+
+	sortResults(results, SortByURL)
+
+	for i, want := range []int{1, 2, 3} {
+		if results[i].URL != "https://a.com" || results[i].Size != want {
+			t.Errorf("wrong result at %d: want size = %d, got = %+v", i, want, results[i])
+		}
+	}
+
+	if results[3].URL != "https://b.com" {
+		t.Errorf("wrong last result: %+v", results[3])
+	}
+}
+
+func TestWithTrimSpace(t *testing.T) {
+	tests := []struct {
+		name   string
+		trim   bool
+		body   string
+		status int
+	}{
+		{name: "leading and trailing spaces", trim: true, body: "  https://test-1.com  \n", status: http.StatusOK},
+		{name: "tabs", trim: true, body: "\thttps://test-1.com\t\n\t\n", status: http.StatusOK},
+		{name: "internal spaces", trim: true, body: "https://test-1.com/a b\n", status: http.StatusBadRequest},
+		{name: "disabled trimming", trim: false, body: " https://test-1.com\n", status: http.StatusBadRequest},
+		{name: "disabled trimming of clean lines", trim: false, body: "https://test-1.com\n", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			if tt.status == http.StatusOK {
+				client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+			}
+
+			handler := newResponseSizeCounter(t, WithTrimSpace(tt.trim))
+			handler.client = client
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(tt.body)),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if res := w.Result(); res.StatusCode != tt.status {
+				t.Errorf("wrong response status: want = %d, got = %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestWithStrictLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		body   string
+		status int
+		lines  []int
+	}{
+		{name: "lenient", strict: false, body: "\nhttps://test-1.com\n  \n", status: http.StatusOK},
+		{name: "strict clean", strict: true, body: "https://test-1.com\n", status: http.StatusOK},
+		{name: "strict blank", strict: true, body: "\nhttps://test-1.com\n  \n", status: http.StatusBadRequest, lines: []int{1, 3}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			if tt.status == http.StatusOK {
+				client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+			}
+
+			handler := newResponseSizeCounter(t, WithStrictLines(tt.strict))
+			handler.client = client
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				Header: http.Header{"Accept": []string{"application/json"}},
+				Body:   io.NopCloser(strings.NewReader(tt.body)),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("wrong response status: want = %d, got = %d", tt.status, w.Code)
+			}
+
+			if tt.status != http.StatusBadRequest {
+				return
+			}
+
+			var body struct {
+				Errors []lineError `json:"errors"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("cannot decode response body: %s", err)
+			}
+
+			if len(body.Errors) != len(tt.lines) {
+				t.Fatalf("wrong number of invalid lines: want = %d, got = %+v", len(tt.lines), body.Errors)
+			}
+			for i, line := range tt.lines {
+				if body.Errors[i].Line != line || body.Errors[i].Error != "is blank" {
+					t.Errorf("wrong invalid line #%d: want line %d, got = %+v", i, line, body.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithAllFailedStatus(t *testing.T) {
+	if got := newResponseSizeCounter(t).allFailedStatus; got != http.StatusBadGateway {
+		t.Errorf("wrong default all-failed status: want = %d, got = %d", http.StatusBadGateway, got)
+	}
+
+	handler := newResponseSizeCounter(t, WithAllFailedStatus(http.StatusServiceUnavailable))
+	if handler.allFailedStatus != http.StatusServiceUnavailable {
+		t.Errorf("wrong all-failed status: want = %d, got = %d", http.StatusServiceUnavailable, handler.allFailedStatus)
+	}
+}
+
+func TestWithRateLimitReset(t *testing.T) {
+	handler := MakeResponseSizeCounter(WithRateLimitReset(map[string]string{"admin": "secret"}))
+
+	serve := func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	status := 0
+	for i := 0; i <= defaultRateLimit; i++ {
+		status = serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("rate limit is not exceeded: got status = %d", status)
+	}
+
+	if got := serve(httptest.NewRequest(http.MethodPost, rateLimitResetPath, nil)); got != http.StatusUnauthorized {
+		t.Errorf("wrong response status of an unauthenticated reset: want = %d, got = %d", http.StatusUnauthorized, got)
+	}
+
+	reset := httptest.NewRequest(http.MethodPost, rateLimitResetPath, nil)
+	reset.SetBasicAuth("admin", "secret")
+	if got := serve(reset); got != http.StatusNoContent {
+		t.Fatalf("wrong response status of a reset: want = %d, got = %d", http.StatusNoContent, got)
+	}
+
+	if got := serve(httptest.NewRequest(http.MethodGet, "/", nil)); got == http.StatusTooManyRequests {
+		t.Error("rate limit counters are not cleared")
+	}
+}
+
+func TestMakeResponseSizeCounter_rateLimitResetDisabled(t *testing.T) {
+	reset := httptest.NewRequest(http.MethodPost, rateLimitResetPath, nil)
+	reset.SetBasicAuth("admin", "secret")
+
+	w := httptest.NewRecorder()
+	MakeResponseSizeCounter().ServeHTTP(w, reset)
+
+	if w.Code == http.StatusNoContent {
+		t.Error("reset endpoint is served without being enabled")
+	}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// totalCountHeader is a response header holding a number of results a page is taken from.
+const totalCountHeader = "X-Total-Count"
+
+// paged reports whether a page of results is requested with 'offset' or 'limit' query parameters.
+func (p params) paged() bool {
+	return p.offset > 0 || p.limit > 0
+}
+
+// page returns bounds of a page of n results requested with 'offset' and 'limit' query parameters.
+// The page is empty if the offset is out of range, it runs till the end if there is no limit.
+func (p params) page(n int) (lo, hi int) {
+	lo, hi = p.offset, n
+	if lo > n {
+		lo = n
+	}
+
+	if p.limit > 0 && lo+p.limit < hi {
+		hi = lo + p.limit
+	}
+
+	return lo, hi
+}
+
+// pageTargets returns targets of a page of results requested by given parameters,
+// ordered the same way their results are, and sets a total number of results to a given header.
+//
+// Results of a request selecting the slowest or the first ones are not known up front,
+// so all of the targets are returned to be paged by pageResults instead.
+func pageTargets(header http.Header, targets []target, p params, order SortOrder) []target {
+	if !p.paged() || p.slowest > 0 || p.first > 0 {
+		return targets
+	}
+
+	if order == SortByURL {
+		sort.SliceStable(targets, func(i, j int) bool {
+			return targets[i].URL < targets[j].URL
+		})
+	}
+
+	header.Set(totalCountHeader, strconv.Itoa(len(targets)))
+
+	lo, hi := p.page(len(targets))
+
+	return targets[lo:hi]
+}
+
+// pageResults returns a page of given results of a request selecting the slowest or the first ones,
+// and sets a total number of results to a given header.
+func pageResults(header http.Header, results []Result, p params) []Result {
+	if !p.paged() || p.slowest == 0 && p.first == 0 {
+		return results
+	}
+
+	header.Set(totalCountHeader, strconv.Itoa(len(results)))
+
+	lo, hi := p.page(len(results))
+
+	return results[lo:hi]
+}
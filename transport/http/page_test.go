@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_page(t *testing.T) {
+	urls := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		urls = append(urls, fmt.Sprintf("https://test-%d.com", i))
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "first page", query: "limit=3", want: urls[:3]},
+		{name: "middle page", query: "offset=4&limit=3", want: urls[4:7]},
+		{name: "last page", query: "offset=8&limit=3", want: urls[8:]},
+		{name: "no limit", query: "offset=7", want: urls[7:]},
+		{name: "out of range offset", query: "offset=10&limit=3", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// only URLs of the page are fetched
+			client := http_mock.NewMockClient(ctrl)
+			for _, url := range tt.want {
+				client.EXPECT().Do(requestTo(url)).Return(response(http.StatusOK), nil)
+			}
+
+			handler := &ResponseSizeCounter{
+				client: client,
+			}
+
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &net_url.URL{RawQuery: tt.query + "&format=json"},
+				Body:   io.NopCloser(strings.NewReader(strings.Join(urls, "\n"))),
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong response status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+
+			if got := w.Header().Get(totalCountHeader); got != "10" {
+				t.Errorf("wrong total count: want = %s, got = %s", "10", got)
+			}
+
+			var results []Result
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("cannot decode response body: %s", err)
+			}
+
+			got := make([]string, 0, len(results))
+			for _, res := range results {
+				got = append(got, res.URL)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("wrong page: want = %v, got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_pageSorted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://b.com")).Return(response(http.StatusOK), nil)
+	client.EXPECT().Do(requestTo("https://c.com")).Return(response(http.StatusOK), nil)
+
+	handler := newResponseSizeCounter(t, WithSort(SortByURL))
+	handler.SetClient(client)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "offset=1&limit=2&format=json"},
+		Body:   io.NopCloser(strings.NewReader("https://d.com\nhttps://b.com\nhttps://a.com\nhttps://c.com")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 2 || results[0].URL != "https://b.com" || results[1].URL != "https://c.com" {
+		t.Errorf("wrong page of sorted results: %+v", results)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_pageSlowest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		return response(http.StatusOK), nil
+	}).Times(4)
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "slowest=3&offset=1&format=json"},
+		Body:   io.NopCloser(strings.NewReader("https://a.com\nhttps://b.com\nhttps://c.com\nhttps://d.com")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	// the slowest results are paged, not the submitted URLs
+	if got := w.Header().Get(totalCountHeader); got != "3" {
+		t.Errorf("wrong total count: want = %s, got = %s", "3", got)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("results count: want = %d, got = %d", 2, len(results))
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongPage(t *testing.T) {
+	for _, query := range []string{"offset=-1", "offset=a", "limit=0", "limit=-5"} {
+		ctrl := gomock.NewController(t)
+
+		handler := &ResponseSizeCounter{
+			client: http_mock.NewMockClient(ctrl),
+		}
+
+		req := request()
+		req.URL = &net_url.URL{RawQuery: query}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: wrong response status: want = %d, got = %d", query, http.StatusBadRequest, w.Code)
+		}
+
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	net_url "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// skippedByHost is a reason of skipping URLs not matching 'host' query parameters.
+const skippedByHost = "host"
+
+// params holds options of a single request passed with query parameters.
+type params struct {
+	slowest int
+	first   int
+	offset  int
+	limit   int
+	echo    bool
+	format  format
+	hosts   []string
+	list    string
+	summary bool
+	// aggregate makes a response hold only a summary of results, without the results.
+	aggregate bool
+	sitemap   bool
+	source    bool
+	export    string
+	// fields are fields of results rendered in CSV and JSON formats, all of them if empty.
+	fields fieldList
+	// streamRate is a minimum interval between streamed results, they are not spaced out if zero.
+	streamRate time.Duration
+}
+
+// parseParams parses and validates query parameters of a given request.
+func parseParams(req *http.Request) (p params, err error) {
+	if p.slowest, err = countParam(req, "slowest", "slowest results"); err != nil {
+		return p, err
+	}
+
+	if p.first, err = countParam(req, "first", "first successful results"); err != nil {
+		return p, err
+	}
+
+	if p.offset, err = offsetParam(req); err != nil {
+		return p, err
+	}
+
+	if p.limit, err = countParam(req, "limit", "results per page"); err != nil {
+		return p, err
+	}
+
+	if p.echo, err = boolParam(req, "echo"); err != nil {
+		return p, err
+	}
+
+	if p.summary, err = boolParam(req, "summary"); err != nil {
+		return p, err
+	}
+
+	if p.aggregate, err = aggregateParam(req); err != nil {
+		return p, err
+	}
+
+	if p.sitemap, err = boolParam(req, "sitemap"); err != nil {
+		return p, err
+	}
+
+	if p.source, err = boolParam(req, "source"); err != nil {
+		return p, err
+	}
+
+	if p.format, err = selectFormat(req); err != nil {
+		return p, err
+	}
+
+	if p.hosts, err = hostParams(req); err != nil {
+		return p, err
+	}
+
+	if p.streamRate, err = streamRateParam(req); err != nil {
+		return p, err
+	}
+
+	p.list = queryParam(req, "list")
+	p.export = queryParam(req, "export")
+
+	human, err := humanUnitsParam(req)
+	if err != nil {
+		return p, err
+	}
+
+	// JSON and other machine-readable formats keep sizes numeric
+	if human && p.format.contentType == textFormat.contentType {
+		p.format = humanTextFormat
+	}
+
+	if p.fields, err = fieldsParam(req); err != nil {
+		return p, err
+	}
+
+	if len(p.fields) > 0 {
+		var ok bool
+		if p.format, ok = p.fields.format(p.format); !ok {
+			return p, errors.New("'fields' is supported by csv and json formats only")
+		}
+	}
+
+	return p, nil
+}
+
+// matchesHost reports whether a given URL is allowed by 'host' query parameters.
+// Every URL matches if there are no such parameters.
+func (p params) matchesHost(url string) bool {
+	if len(p.hosts) == 0 {
+		return true
+	}
+
+	u, err := net_url.Parse(url)
+	if err != nil {
+		return false
+	}
+
+	for _, host := range p.hosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// aggregateParam reports whether only aggregate statistics are requested with 'aggregate=only' query parameter.
+func aggregateParam(req *http.Request) (bool, error) {
+	switch param := queryParam(req, "aggregate"); param {
+	case "":
+		return false, nil
+	case "only":
+		return true, nil
+	default:
+		return false, fmt.Errorf("aggregate must be 'only', got '%s'", param)
+	}
+}
+
+// boolParam reports whether a flag is set with a given query parameter, e.g. 'echo' or 'summary'.
+func boolParam(req *http.Request, name string) (bool, error) {
+	param := queryParam(req, name)
+	if param == "" {
+		return false, nil
+	}
+
+	flag, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not a boolean %s flag", param, name)
+	}
+
+	return flag, nil
+}
+
+// countParam returns a number of results requested with a given query parameter, e.g. 'slowest',
+// zero if the parameter is absent.
+func countParam(req *http.Request, name, what string) (int, error) {
+	param := queryParam(req, name)
+	if param == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("'%s' is not a positive number of %s", param, what)
+	}
+
+	return n, nil
+}
+
+// offsetParam returns a number of results preceding a page requested with 'offset' query parameter,
+// zero if the parameter is absent.
+func offsetParam(req *http.Request) (int, error) {
+	param := queryParam(req, "offset")
+	if param == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("'%s' is not a non-negative offset of results", param)
+	}
+
+	return n, nil
+}
+
+// streamRateParam returns an interval between streamed results requested with 'stream_rate' query parameter,
+// e.g. '500ms', zero if the parameter is absent.
+func streamRateParam(req *http.Request) (time.Duration, error) {
+	param := queryParam(req, "stream_rate")
+	if param == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(param)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("'%s' is not a positive interval of streamed results", param)
+	}
+
+	return interval, nil
+}
+
+// humanUnitsParam reports whether sizes are requested in human-readable units with 'units' query parameter.
+func humanUnitsParam(req *http.Request) (bool, error) {
+	switch param := queryParam(req, "units"); param {
+	case "", "bytes":
+		return false, nil
+	case "human":
+		return true, nil
+	default:
+		return false, fmt.Errorf("'%s' is not supported units", param)
+	}
+}
+
+// hostParams returns hosts given with repeatable 'host' query parameter.
+func hostParams(req *http.Request) ([]string, error) {
+	if req.URL == nil {
+		return nil, nil
+	}
+
+	hosts := req.URL.Query()["host"]
+	for _, host := range hosts {
+		u, err := net_url.Parse("//" + host)
+		if err != nil || host == "" || u.Host != host {
+			return nil, fmt.Errorf("'%s' is not a host", host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// selectFormat picks an output format by 'format' query parameter of a given request,
+// which takes precedence over the Accept header.
+func selectFormat(req *http.Request) (format, error) {
+	param := queryParam(req, "format")
+	if param == "" {
+		return negotiateFormat(req), nil
+	}
+
+	f, ok := formats[param]
+	if !ok {
+		return format{}, fmt.Errorf("'%s' is not a supported format", param)
+	}
+
+	return f, nil
+}
+
+func queryParam(req *http.Request, name string) string {
+	if req.URL == nil {
+		return ""
+	}
+
+	return req.URL.Query().Get(name)
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_hostFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-1.com")).Return(response(http.StatusOK), nil)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := request()
+	req.URL = &net_url.URL{RawQuery: "host=TEST-1.com&format=json"}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	var results []Result
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("results count: want = %d, got = %d", 3, len(results))
+	}
+
+	for _, result := range results {
+		switch result.URL {
+		case "https://test-1.com":
+			if result.Skipped != "" || result.Size != 25000 {
+				t.Errorf("matching url is not fetched: %+v", result)
+			}
+		default:
+			if result.Skipped != skippedByHost || result.Size != 0 {
+				t.Errorf("not matching url is not skipped: %+v", result)
+			}
+		}
+	}
+}
+
+func TestParseParams_wrongHost(t *testing.T) {
+	for _, host := range []string{"", "test-1.com/path", "https://test-1.com", "test 1.com"} {
+		req := &http.Request{URL: &net_url.URL{RawQuery: net_url.Values{"host": []string{host}}.Encode()}}
+
+		if _, err := parseParams(req); err == nil {
+			t.Errorf("wrong host filter '%s' is accepted", host)
+		}
+	}
+}
+
+func TestParams_matchesHost(t *testing.T) {
+	p := params{hosts: []string{"test-1.com", "test-2.com:8080"}}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://test-1.com/path", want: true},
+		{url: "https://test-1.com:443", want: true},
+		{url: "http://test-2.com:8080", want: true},
+		{url: "http://test-2.com", want: false},
+		{url: "https://test-3.com", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := p.matchesHost(tt.url); got != tt.want {
+			t.Errorf("wrong host match of %s: want = %t, got = %t", tt.url, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Protocol Buffers wire types, see https://protobuf.dev/programming-guides/encoding.
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+// writeProtobuf writes results as a Results message of results.proto.
+//
+// Each result is written as soon as it is encoded, so the whole message is never held in memory.
+// Recorded requests and attempts are not rendered.
+func writeProtobuf(w io.Writer, results resultSource) error {
+	var msg []byte
+
+	return results.each(func(res Result) error {
+		msg = appendProtoResult(msg[:0], res)
+
+		field := appendProtoTag(nil, 1, protoBytes)
+		field = appendProtoVarint(field, uint64(len(msg)))
+
+		if _, err := w.Write(field); err != nil {
+			return err
+		}
+		_, err := w.Write(msg)
+		return err
+	})
+}
+
+// appendProtoResult appends a Result message of results.proto encoding a given result to b.
+// Fields having default values are omitted, as proto3 does.
+func appendProtoResult(b []byte, res Result) []byte {
+	b = appendProtoString(b, 1, res.URL)
+	b = appendProtoInt(b, 2, int64(res.Size))
+	b = appendProtoInt(b, 3, int64(res.Latency))
+	b = appendProtoInt(b, 4, int64(res.TTFB))
+	b = appendProtoString(b, 5, res.Error)
+	b = appendProtoString(b, 6, res.Skipped)
+	b = appendProtoString(b, 7, res.Hash)
+	b = appendProtoBool(b, 8, res.Truncated)
+	b = appendProtoInt(b, 9, res.AdvertisedSize)
+	if res.Expected != nil {
+		// an optional field is written even if it has a default value
+		b = appendProtoTag(b, 10, protoVarint)
+		b = appendProtoVarint(b, uint64(*res.Expected))
+	}
+	b = appendProtoBool(b, 11, res.Matched)
+
+	return b
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = appendProtoTag(b, field, protoBytes)
+	b = appendProtoVarint(b, uint64(len(s)))
+
+	return append(b, s...)
+}
+
+func appendProtoInt(b []byte, field int, n int64) []byte {
+	if n == 0 {
+		return b
+	}
+
+	b = appendProtoTag(b, field, protoVarint)
+
+	return appendProtoVarint(b, uint64(n))
+}
+
+func appendProtoBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+
+	return appendProtoInt(b, field, 1)
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return appendProtoVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+
+	return append(b, buf[:n]...)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_writeProtobuf(t *testing.T) {
+	expected := 0
+	results := []Result{
+		{
+			URL:            "http://example.com",
+			Size:           1256,
+			Latency:        120 * time.Millisecond,
+			TTFB:           80 * time.Millisecond,
+			Hash:           "abc",
+			Truncated:      true,
+			AdvertisedSize: 4096,
+			Expected:       &expected,
+		},
+		{URL: "http://fail.com", Error: "connection refused"},
+		{URL: "http://image.com", Skipped: skippedByType},
+	}
+
+	var buf bytes.Buffer
+	if err := writeProtobuf(&buf, resultSlice(results)); err != nil {
+		t.Fatalf("cannot write results: %s", err)
+	}
+
+	got, err := decodeProtoResults(buf.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decode results: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, results) {
+		t.Errorf("wrong results: want = %+v, got = %+v", results, got)
+	}
+}
+
+// decodeProtoResults decodes a Results message of results.proto.
+func decodeProtoResults(b []byte) ([]Result, error) {
+	var results []Result
+
+	err := decodeProtoFields(b, func(field int, v uint64, data []byte) error {
+		if field != 1 || data == nil {
+			return errors.New("unexpected field of Results")
+		}
+
+		var res Result
+		if err := decodeProtoFields(data, func(field int, v uint64, data []byte) error {
+			switch field {
+			case 1:
+				res.URL = string(data)
+			case 2:
+				res.Size = int(v)
+			case 3:
+				res.Latency = time.Duration(v)
+			case 4:
+				res.TTFB = time.Duration(v)
+			case 5:
+				res.Error = string(data)
+			case 6:
+				res.Skipped = string(data)
+			case 7:
+				res.Hash = string(data)
+			case 8:
+				res.Truncated = v != 0
+			case 9:
+				res.AdvertisedSize = int64(v)
+			case 10:
+				expected := int(v)
+				res.Expected = &expected
+			case 11:
+				res.Matched = v != 0
+			default:
+				return errors.New("unexpected field of Result")
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		results = append(results, res)
+		return nil
+	})
+
+	return results, err
+}
+
+// decodeProtoFields calls fn for every field of an encoded message
+// with either a varint value or a length-delimited data.
+func decodeProtoFields(b []byte, fn func(field int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed tag")
+		}
+		b = b[n:]
+
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed value")
+		}
+		b = b[n:]
+
+		var data []byte
+		switch tag & 7 {
+		case protoVarint:
+		case protoBytes:
+			if uint64(len(b)) < v {
+				return errors.New("truncated data")
+			}
+			data, b = b[:v:v], b[v:]
+		default:
+			return errors.New("unexpected wire type")
+		}
+
+		if err := fn(int(tag>>3), v, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// redactedValue replaces values of headers holding secrets in recorded requests.
+const redactedValue = "REDACTED"
+
+// secretHeaders are headers holding secrets, their values are never recorded.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// secretHeaderWords mark names of custom headers holding secrets, e.g. X-Api-Key or X-Auth-Token.
+var secretHeaderWords = []string{"key", "token", "secret", "password"}
+
+// RecordedRequest describes an outbound request performed to fetch a URL.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	// URL is the request URL having a password, if any, redacted.
+	URL string `json:"url"`
+	// Header holds headers set on the request having values of ones holding secrets redacted.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// recordRequest describes a given outbound request. A body of the request is not recorded.
+func recordRequest(req *http.Request) *RecordedRequest {
+	rec := &RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.Redacted(),
+	}
+
+	if len(req.Header) > 0 {
+		rec.Header = make(http.Header, len(req.Header))
+		for name, values := range req.Header {
+			if isSecretHeader(name) {
+				values = []string{redactedValue}
+			}
+			rec.Header[name] = append([]string(nil), values...)
+		}
+	}
+
+	return rec
+}
+
+// isSecretHeader reports whether a header of a given canonical name holds a secret.
+func isSecretHeader(name string) bool {
+	if secretHeaders[name] {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, word := range secretHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// RedirectSizeMode defines which responses of a redirect chain count toward a reported size.
+type RedirectSizeMode int
+
+const (
+	// RedirectSizeFinal counts only a body of the final response.
+	RedirectSizeFinal RedirectSizeMode = iota
+	// RedirectSizeSum counts bodies of intermediate redirect responses along with the final one.
+	RedirectSizeSum
+)
+
+// SchemeDowngradeMode defines how redirects downgrading a scheme from https to http are handled.
+type SchemeDowngradeMode int
+
+const (
+	// SchemeDowngradeFollow follows downgrading redirects as any other ones.
+	SchemeDowngradeFollow SchemeDowngradeMode = iota
+	// SchemeDowngradeFlag follows downgrading redirects, flagging results of URLs redirected so.
+	SchemeDowngradeFlag
+	// SchemeDowngradeBlock fails fetches of URLs redirecting to http ones.
+	SchemeDowngradeBlock
+)
+
+// defaultMaxRedirects is a number of redirects followed before a fetch fails, the same as of http.Client.
+const defaultMaxRedirects = 10
+
+// errTooManyRedirects fails fetches of URLs redirecting more times than allowed.
+var errTooManyRedirects = errors.New("too many redirects")
+
+// errSchemeDowngrade fails fetches of https URLs redirecting to http ones, if they are blocked.
+var errSchemeDowngrade = errors.New("scheme downgrade")
+
+// errFileRedirect fails fetches of URLs redirecting to local files.
+var errFileRedirect = errors.New("redirect to a local file")
+
+// redirectSizeKey is a context key of a counter of redirect responses bodies sizes.
+type redirectSizeKey struct{}
+
+// withRedirectSize returns a copy of ctx making redirect responses bodies sizes added to size.
+func withRedirectSize(ctx context.Context, size *int) context.Context {
+	return context.WithValue(ctx, redirectSizeKey{}, size)
+}
+
+// schemeDowngradeKey is a context key of a flag of a redirect downgrading a scheme.
+type schemeDowngradeKey struct{}
+
+// withSchemeDowngrade returns a copy of ctx making a redirect from https to http set downgraded.
+func withSchemeDowngrade(ctx context.Context, downgraded *bool) context.Context {
+	return context.WithValue(ctx, schemeDowngradeKey{}, downgraded)
+}
+
+// checkRedirect is a CheckRedirect function of the default client.
+//
+// It adds a size of a redirect response body to a counter of the request context, if any,
+// and follows up to the maximum number of redirects to allowed hosts, but not to local files.
+// Redirects of list sources are followed to http and https URLs only.
+// Redirects from https to http are flagged or blocked depending on a scheme downgrade mode.
+func (h *ResponseSizeCounter) checkRedirect(req *http.Request, via []*http.Request) error {
+	if size, ok := req.Context().Value(redirectSizeKey{}).(*int); ok && req.Response != nil {
+		n, err := io.Copy(io.Discard, req.Response.Body)
+		if err != nil {
+			return err
+		}
+		*size += int(n)
+	}
+
+	if len(via) > h.maxRedirects {
+		return errTooManyRedirects
+	}
+
+	if !h.allowedHosts.allows(req.URL.String()) {
+		return fmt.Errorf("redirect to '%s': %w", req.URL.Host, errHostNotAllowed)
+	}
+
+	// schemes other than http and https never dial, so the dialer doesn't check them
+	if publicOnly, _ := req.Context().Value(publicOnlyKey{}).(bool); publicOnly && !isHTTPURL(req.URL.String()) {
+		return fmt.Errorf("redirect to '%s': %w", req.URL, errSourceNotAllowed)
+	}
+
+	// only URLs a client submits itself are able to read local files
+	if req.URL.Scheme == fileScheme {
+		return fmt.Errorf("redirect to '%s': %w", req.URL, errFileRedirect)
+	}
+
+	if len(via) > 0 && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+		switch h.schemeDowngradeMode {
+		case SchemeDowngradeFlag:
+			if downgraded, ok := req.Context().Value(schemeDowngradeKey{}).(*bool); ok {
+				*downgraded = true
+			}
+		case SchemeDowngradeBlock:
+			return fmt.Errorf("redirect to '%s': %w", req.URL, errSchemeDowngrade)
+		}
+	}
+
+	return nil
+}
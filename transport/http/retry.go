@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Attempt describes a single attempt of fetching a URL.
+type Attempt struct {
+	// Status is a status code of the response, zero if there is none.
+	Status int `json:"status,omitempty"`
+	// Error describes why the attempt failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Size is a size of the response body, zero if the attempt failed.
+	Size int `json:"size,omitempty"`
+	// Latency is a time spent by the attempt, in nanoseconds when rendered as JSON.
+	Latency time.Duration `json:"latency"`
+}
+
+// RetrySizePolicy defines which attempt of fetching a URL with retries reports its size,
+// as a URL of dynamic content is able to respond with a different size to each attempt.
+//
+// The size is picked among successful attempts only, neither failed nor responded with a server error status,
+// so it agrees with a status, a hash and a protocol of the result, which are of the last attempt.
+type RetrySizePolicy int
+
+const (
+	// RetrySizeLast reports a size of the last attempt.
+	RetrySizeLast RetrySizePolicy = iota
+	// RetrySizeFirst reports a size of the first successful attempt.
+	RetrySizeFirst
+	// RetrySizeMax reports the largest size of attempts.
+	RetrySizeMax
+	// RetrySizeMin reports the smallest size of attempts.
+	RetrySizeMin
+)
+
+// size returns a size of given attempts picked by the policy, false if no attempt is successful.
+func (p RetrySizePolicy) size(attempts []Attempt) (int, bool) {
+	size, ok := 0, false
+	for _, a := range attempts {
+		// a retried server error response is an error page rather than the content
+		if a.Error != "" || a.Status >= http.StatusInternalServerError {
+			continue
+		}
+
+		switch {
+		case !ok, p == RetrySizeLast, p == RetrySizeMax && a.Size > size, p == RetrySizeMin && a.Size < size:
+			size = a.Size
+		}
+		ok = true
+
+		if p == RetrySizeFirst {
+			break
+		}
+	}
+
+	return size, ok
+}
+
+// doWithRetries performs a request of a given target, repeating it up to the number of retries
+// while it fails or is responded with a server error status.
+//
+// If there is a retry budget, repetitions stop once a time spent since the first attempt along with
+// the delay before the next one reaches it, and a repetition in progress is cancelled when the budget runs out.
+//
+// The last attempt makes the result, outcomes of all attempts are recorded to its Attempts if retries are enabled.
+// Its size is replaced by one of an attempt picked by the retry size policy, unless the last attempt failed.
+func (h *ResponseSizeCounter) doWithRetries(ctx context.Context, t target) (Result, error) {
+	if h.retries == 0 {
+		return h.doWithTimeout(ctx, t)
+	}
+
+	start := time.Now()
+
+	// the first attempt is limited by the fetch timeout only
+	retryCtx := ctx
+	if h.retryBudget > 0 {
+		var cancel context.CancelFunc
+		retryCtx, cancel = context.WithDeadline(ctx, start.Add(h.retryBudget))
+		defer cancel()
+	}
+
+	attempts := make([]Attempt, 0, h.retries+1)
+	finish := func(result Result, err error) (Result, error) {
+		result.Attempts = attempts
+		if size, ok := h.retrySizePolicy.size(attempts); ok && err == nil {
+			result.Size = size
+		}
+		return result, err
+	}
+
+	for i := 0; ; i++ {
+		attemptCtx := ctx
+		if i > 0 {
+			attemptCtx = retryCtx
+		}
+
+		result, err := h.doWithTimeout(attemptCtx, t)
+
+		attempt := Attempt{Status: result.status, Latency: result.Latency}
+		if err != nil {
+			attempt.Error = err.Error()
+		} else {
+			attempt.Size = result.Size
+		}
+		attempts = append(attempts, attempt)
+
+		if i == h.retries || (err == nil && result.status < http.StatusInternalServerError) {
+			return finish(result, err)
+		}
+
+		if h.retryBudget > 0 && time.Since(start)+h.retryDelay >= h.retryBudget {
+			return finish(result, err)
+		}
+
+		select {
+		case <-time.After(h.retryDelay):
+		case <-ctx.Done():
+			return finish(result, err)
+		}
+	}
+}
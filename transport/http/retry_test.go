@@ -0,0 +1,261 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_retries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	gomock.InOrder(
+		client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")),
+		client.EXPECT().Do(gomock.Any()).Return(response(http.StatusServiceUnavailable), nil),
+		client.EXPECT().Do(gomock.Any()).Return(response(http.StatusOK), nil),
+	)
+
+	handler := newResponseSizeCounter(t, WithRetries(3, 0))
+	handler.SetClient(client)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{"Accept": []string{"application/json"}},
+		Body:   io.NopCloser(strings.NewReader("https://flaky.com")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("wrong number of results: want = %d, got = %d", 1, len(results))
+	}
+
+	res := results[0]
+	if res.Error != "" || res.Size != 25*1000 {
+		t.Errorf("result of the last attempt is not reported: %+v", res)
+	}
+
+	if len(res.Attempts) != 3 {
+		t.Fatalf("wrong number of attempts: want = %d, got = %d", 3, len(res.Attempts))
+	}
+
+	if a := res.Attempts[0]; a.Status != 0 || !strings.Contains(a.Error, "connection reset") {
+		t.Errorf("wrong failed attempt: %+v", a)
+	}
+	if a := res.Attempts[1]; a.Status != http.StatusServiceUnavailable || a.Error != "" {
+		t.Errorf("wrong server error attempt: %+v", a)
+	}
+	if a := res.Attempts[2]; a.Status != http.StatusOK || a.Error != "" {
+		t.Errorf("wrong succeeded attempt: %+v", a)
+	}
+}
+
+func TestResponseSizeCounter_doWithRetries_bounded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection refused")).Times(3)
+
+	handler := newResponseSizeCounter(t, WithRetries(2, 0))
+	handler.SetClient(client)
+
+	result, err := handler.doWithRetries(context.Background(), target{URL: "https://down.com"})
+	if err == nil {
+		t.Error("failed fetch is reported as succeeded")
+	}
+
+	if len(result.Attempts) != 3 {
+		t.Errorf("wrong number of attempts: want = %d, got = %d", 3, len(result.Attempts))
+	}
+}
+
+func TestResponseSizeCounter_doWithRetries_disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection refused")).Times(1)
+
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(client)
+
+	result, _ := handler.doWithRetries(context.Background(), target{URL: "https://down.com"})
+	if result.Attempts != nil {
+		t.Errorf("attempts are recorded with retries disabled: %+v", result.Attempts)
+	}
+}
+
+func TestWithRetryBudget(t *testing.T) {
+	const (
+		delay  = 20 * time.Millisecond
+		budget = 100 * time.Millisecond
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection refused")).MinTimes(2).MaxTimes(5)
+
+	handler := newResponseSizeCounter(t, WithRetries(100, delay), WithRetryBudget(budget))
+	handler.SetClient(client)
+
+	start := time.Now()
+
+	result, err := handler.doWithRetries(context.Background(), target{URL: "https://down.com"})
+	if err == nil {
+		t.Fatal("failing fetch succeeded")
+	}
+
+	// no repetition starts after the budget runs out
+	if elapsed := time.Since(start); elapsed > budget+delay {
+		t.Errorf("retrying took %s exceeding the budget of %s", elapsed, budget)
+	}
+
+	if n := len(result.Attempts); n < 2 || n > 5 {
+		t.Errorf("wrong number of attempts within the budget: %d", n)
+	}
+}
+
+func TestWithRetryBudget_inProgress(t *testing.T) {
+	const budget = 50 * time.Millisecond
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the first attempt fails at once, a repetition hangs till it is cancelled
+	client := http_mock.NewMockClient(ctrl)
+	gomock.InOrder(
+		client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")),
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}),
+	)
+
+	handler := newResponseSizeCounter(t, WithRetries(3, 0), WithRetryBudget(budget))
+	handler.SetClient(client)
+
+	start := time.Now()
+
+	result, err := handler.doWithRetries(context.Background(), target{URL: "https://hanging.com"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error: want = %s, got = %v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed < budget || elapsed > 4*budget {
+		t.Errorf("repetition is not cancelled by the budget of %s: took %s", budget, elapsed)
+	}
+
+	if len(result.Attempts) != 2 {
+		t.Errorf("wrong number of attempts: want = %d, got = %d", 2, len(result.Attempts))
+	}
+}
+
+func TestWithRetrySizePolicy(t *testing.T) {
+	sized := func(status, size int) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(strings.Repeat("0", size)))}
+	}
+
+	// error pages of retried server errors are larger and smaller than the content, but are never reported
+	for _, policy := range []RetrySizePolicy{RetrySizeLast, RetrySizeFirst, RetrySizeMax, RetrySizeMin} {
+		ctrl := gomock.NewController(t)
+
+		client := http_mock.NewMockClient(ctrl)
+		gomock.InOrder(
+			client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")),
+			client.EXPECT().Do(gomock.Any()).Return(sized(http.StatusServiceUnavailable, 35), nil),
+			client.EXPECT().Do(gomock.Any()).Return(sized(http.StatusBadGateway, 30), nil),
+			client.EXPECT().Do(gomock.Any()).Return(sized(http.StatusBadGateway, 10), nil),
+			client.EXPECT().Do(gomock.Any()).Return(sized(http.StatusOK, 20), nil),
+		)
+
+		handler := newResponseSizeCounter(t, WithRetries(4, 0), WithRetrySizePolicy(policy))
+		handler.SetClient(client)
+
+		result, err := handler.doWithRetries(context.Background(), target{URL: "https://dynamic.com"})
+		if err != nil {
+			t.Fatalf("policy %d: unexpected error: %v", policy, err)
+		}
+
+		if result.Size != 20 {
+			t.Errorf("policy %d: wrong size: want = %d, got = %d", policy, 20, result.Size)
+		}
+		if result.status != http.StatusOK || len(result.Attempts) != 5 {
+			t.Errorf("policy %d: result of the last attempt is not reported: %+v", policy, result)
+		}
+
+		ctrl.Finish()
+	}
+}
+
+func TestRetrySizePolicy_size(t *testing.T) {
+	attempts := []Attempt{
+		{Status: http.StatusServiceUnavailable, Size: 500},
+		{Status: http.StatusOK, Size: 20},
+		{Status: http.StatusOK, Size: 10},
+		{Error: "connection reset"},
+		{Status: http.StatusOK, Size: 30},
+	}
+
+	for policy, want := range map[RetrySizePolicy]int{
+		RetrySizeLast:  30,
+		RetrySizeFirst: 20,
+		RetrySizeMax:   30,
+		RetrySizeMin:   10,
+	} {
+		if got, ok := policy.size(attempts); !ok || got != want {
+			t.Errorf("policy %d: wrong size: want = %d, got = %d", policy, want, got)
+		}
+	}
+
+	if _, ok := RetrySizeMax.size(attempts[:1]); ok {
+		t.Error("size of a server error response is picked")
+	}
+}
+
+func TestWithRetrySizePolicy_lastAttemptFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	gomock.InOrder(
+		client.EXPECT().Do(gomock.Any()).Return(response(http.StatusServiceUnavailable), nil),
+		client.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")),
+	)
+
+	handler := newResponseSizeCounter(t, WithRetries(1, 0), WithRetrySizePolicy(RetrySizeMax))
+	handler.SetClient(client)
+
+	result, err := handler.doWithRetries(context.Background(), target{URL: "https://flaky.com"})
+	if err == nil {
+		t.Fatal("failure of the last attempt is not reported")
+	}
+
+	if result.Size != 0 {
+		t.Errorf("size of a failed fetch is replaced: %d", result.Size)
+	}
+	if result.Attempts[0].Size != 25*1000 {
+		t.Errorf("wrong size of the first attempt: want = %d, got = %d", 25*1000, result.Attempts[0].Size)
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// shuffler randomizes an order URLs of a request are fetched in.
+type shuffler struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newShuffler(seed int64) *shuffler {
+	return &shuffler{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// perm returns a random permutation of positions of n targets.
+func (s *shuffler) perm(n int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rnd.Perm(n)
+}
+
+// fetchOrder returns positions of n targets in an order they are fetched in,
+// which is random if shuffling is enabled, and the order of the targets otherwise.
+func (h *ResponseSizeCounter) fetchOrder(n int) []int {
+	if h.shuffle != nil {
+		return h.shuffle.perm(n)
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+
+	return order
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithShuffleSeed(t *testing.T) {
+	const seed = 42
+
+	targets := make([]target, 0, 8)
+	for i := 0; i < 8; i++ {
+		targets = append(targets, target{URL: fmt.Sprintf("https://test-%d.com", i)})
+	}
+
+	fetched := func() []string {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var order []string
+
+		client := http_mock.NewMockClient(ctrl)
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			order = append(order, req.URL.String())
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+			}, nil
+		}).Times(len(targets))
+
+		// fetches one by one start in the order they are submitted to the group
+		handler := newResponseSizeCounter(t, WithShuffleSeed(seed), WithMaxConcurrentFetches(1))
+		handler.SetClient(client)
+
+		results, err := handler.getRespSizes(context.Background(), targets, params{})
+		if err != nil {
+			t.Fatalf("cannot get response sizes: %s", err)
+		}
+
+		for i, result := range results {
+			if result.URL != targets[i].URL {
+				t.Errorf("wrong result order: want %s at %d, got %s", targets[i].URL, i, result.URL)
+			}
+		}
+
+		return order
+	}
+
+	want := make([]string, 0, len(targets))
+	for _, i := range newShuffler(seed).perm(len(targets)) {
+		want = append(want, targets[i].URL)
+	}
+
+	got := fetched()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong fetch order: want = %v, got = %v", want, got)
+	}
+
+	if again := fetched(); !reflect.DeepEqual(again, got) {
+		t.Errorf("fetch order is not deterministic: first = %v, second = %v", got, again)
+	}
+
+	submitted := make([]string, 0, len(targets))
+	for _, t := range targets {
+		submitted = append(submitted, t.URL)
+	}
+
+	if reflect.DeepEqual(got, submitted) {
+		t.Errorf("fetch order is not shuffled: %v", got)
+	}
+}
+
+func TestWithShuffle(t *testing.T) {
+	if newResponseSizeCounter(t, WithShuffle(true)).shuffle == nil {
+		t.Error("shuffling is not enabled")
+	}
+
+	if newResponseSizeCounter(t, WithShuffleSeed(1), WithShuffle(false)).shuffle != nil {
+		t.Error("shuffling is not disabled")
+	}
+
+	handler := newResponseSizeCounter(t)
+	if order := handler.fetchOrder(3); !reflect.DeepEqual(order, []int{0, 1, 2}) {
+		t.Errorf("wrong default fetch order: want = %v, got = %v", []int{0, 1, 2}, order)
+	}
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxSitemapURLs limits a number of URLs sitemaps of a single request expand to,
+// the same as the sitemap protocol limits a single sitemap to.
+const maxSitemapURLs = 50000
+
+// maxSitemapBytes limits an uncompressed size of a single sitemap, the same as the sitemap protocol does.
+const maxSitemapBytes = 50 * 1024 * 1024
+
+// sitemap is either a set of URLs or an index of sitemaps, see https://www.sitemaps.org/protocol.html.
+type sitemap struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// expandSitemaps fetches sitemaps of given targets and returns targets of the URLs they list.
+//
+// A sitemap may be gzipped. Sitemaps listed by a sitemap index are expanded as well,
+// while nested indexes are not allowed by the protocol and fail the expansion.
+// Sitemaps of hosts out of the allowlist fail the expansion before being fetched.
+func (h *ResponseSizeCounter) expandSitemaps(ctx context.Context, sitemaps []target) ([]target, error) {
+	if err := h.allowedHosts.disallowed(sitemaps); err != nil {
+		return nil, fmt.Errorf("sitemap %w", err)
+	}
+
+	urls := make([]string, 0)
+
+	for _, t := range sitemaps {
+		sm, err := h.getSitemap(ctx, t.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		locs := sm.URLs
+		if sm.XMLName.Local == "sitemapindex" {
+			locs = nil
+			for _, index := range sm.Sitemaps {
+				if !h.allowedHosts.allows(index.Loc) {
+					return nil, fmt.Errorf("sitemap '%s' of index '%s': %w", index.Loc, t.URL, errHostNotAllowed)
+				}
+
+				child, err := h.getSitemap(ctx, index.Loc)
+				if err != nil {
+					return nil, err
+				}
+
+				if child.XMLName.Local != "urlset" {
+					return nil, fmt.Errorf("sitemap '%s' of index '%s' is not a set of URLs", index.Loc, t.URL)
+				}
+
+				// children left are not fetched once the limit is exceeded
+				locs = append(locs, child.URLs...)
+				if len(urls)+len(locs) > maxSitemapURLs {
+					return nil, fmt.Errorf("sitemaps list more than %d URLs", maxSitemapURLs)
+				}
+			}
+		}
+
+		for _, loc := range locs {
+			if len(urls) == maxSitemapURLs {
+				return nil, fmt.Errorf("sitemaps list more than %d URLs", maxSitemapURLs)
+			}
+
+			if !isUrl(loc.Loc) {
+				return nil, fmt.Errorf("'%s' of sitemap '%s' is not a URL", loc.Loc, t.URL)
+			}
+
+			urls = append(urls, loc.Loc)
+		}
+	}
+
+	return urlTargets(urls), nil
+}
+
+// getSitemap fetches and parses a sitemap of a given URL.
+func (h *ResponseSizeCounter) getSitemap(ctx context.Context, url string) (sm sitemap, err error) {
+	url = strings.TrimSpace(url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return sm, fmt.Errorf("sitemap '%s': %s", url, err)
+	}
+
+	res, err := h.getter().Do(req)
+	if err != nil {
+		return sm, fmt.Errorf("sitemap '%s': %s", url, err)
+	}
+	defer closeResBody(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return sm, fmt.Errorf("sitemap '%s': unexpected status %d", url, res.StatusCode)
+	}
+
+	body := bufio.NewReader(res.Body)
+
+	var r io.Reader = body
+	if magic, _ := body.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return sm, fmt.Errorf("sitemap '%s': %s", url, err)
+		}
+		defer closeGzipReader(gz)
+
+		r = gz
+	}
+
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapBytes)).Decode(&sm); err != nil {
+		return sm, fmt.Errorf("sitemap '%s': %s", url, err)
+	}
+
+	if sm.XMLName.Local != "urlset" && sm.XMLName.Local != "sitemapindex" {
+		return sm, fmt.Errorf("sitemap '%s': unexpected root element '%s'", url, sm.XMLName.Local)
+	}
+
+	for i := range sm.URLs {
+		sm.URLs[i].Loc = strings.TrimSpace(sm.URLs[i].Loc)
+	}
+	for i := range sm.Sitemaps {
+		sm.Sitemaps[i].Loc = strings.TrimSpace(sm.Sitemaps[i].Loc)
+	}
+
+	return sm, nil
+}
+
+// sitemapErrorStatus returns a response status for a given error of expanding sitemaps.
+func sitemapErrorStatus(err error) int {
+	if errors.Is(err, errHostNotAllowed) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadGateway
+}
+
+func closeGzipReader(gz *gzip.Reader) {
+	if err := gz.Close(); err != nil {
+		log.Printf("close gzip reader: %s", err)
+	}
+}
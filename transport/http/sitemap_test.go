@@ -0,0 +1,197 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestResponseSizeCounter_ServeHTTP_sitemap(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/pages.xml.gz</loc></sitemap>
+	<sitemap><loc>%[1]s/posts.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		case "/pages.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%[1]s/a</loc></url>
+	<url><loc>%[1]s/b</loc></url>
+</urlset>`, srv.URL)
+			_ = gz.Close()
+			_, _ = w.Write(buf.Bytes())
+		case "/posts.xml":
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url>
+		<loc>
+			%s/c
+		</loc>
+	</url>
+</urlset>`, srv.URL)
+		default:
+			_, _ = w.Write([]byte(strings.Repeat("0", 100)))
+		}
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "sitemap=true&format=json"},
+		Body:   io.NopCloser(strings.NewReader(srv.URL + "/sitemap.xml")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	urls := make([]string, 0, len(results))
+	for _, res := range results {
+		if res.Size != 100 {
+			t.Errorf("wrong size of %s: want = %d, got = %d", res.URL, 100, res.Size)
+		}
+		urls = append(urls, strings.TrimPrefix(res.URL, srv.URL))
+	}
+	sort.Strings(urls)
+
+	if want := []string{"/a", "/b", "/c"}; strings.Join(urls, ",") != strings.Join(want, ",") {
+		t.Errorf("wrong measured URLs: want = %v, got = %v", want, urls)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongSitemap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/html":
+			_, _ = w.Write([]byte("<html></html>"))
+		case "/broken":
+			_, _ = w.Write([]byte("<urlset><url><loc>not a url</loc></url></urlset>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t)
+
+	for _, path := range []string{"/html", "/broken", "/missing"} {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{RawQuery: "sitemap=true"},
+			Body:   io.NopCloser(strings.NewReader(srv.URL + path)),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("wrong sitemap %s handled incorrectly: status = %d", path, w.Code)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_sitemapNotAllowed(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		_, _ = w.Write([]byte(`<sitemapindex><sitemap><loc>https://internal.test/sitemap.xml</loc></sitemap></sitemapindex>`))
+	}))
+	defer srv.Close()
+
+	srvURL, _ := net_url.Parse(srv.URL)
+
+	for name, tt := range map[string]struct {
+		allowed []string
+		want    []string
+	}{
+		"sitemap":  {allowed: []string{"example.com"}, want: nil},
+		"of index": {allowed: []string{srvURL.Hostname()}, want: []string{"/index.xml"}},
+	} {
+		requested = nil
+
+		handler := newResponseSizeCounter(t, WithAllowedHosts(tt.allowed))
+
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{RawQuery: "sitemap=true"},
+			Body:   io.NopCloser(strings.NewReader(srv.URL + "/index.xml")),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: wrong response status: want = %d, got = %d: %s", name, http.StatusForbidden, w.Code, w.Body)
+		}
+		if strings.Join(requested, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: wrong requested sitemaps: want = %v, got = %v", name, tt.want, requested)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_sitemapIndexLimit(t *testing.T) {
+	var requested []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+
+		switch req.URL.Path {
+		case "/index.xml":
+			fmt.Fprintf(w, `<sitemapindex>
+	<sitemap><loc>%[1]s/large.xml</loc></sitemap>
+	<sitemap><loc>%[1]s/next.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		default:
+			_, _ = io.WriteString(w, "<urlset>")
+			for i := 0; i <= maxSitemapURLs; i++ {
+				fmt.Fprintf(w, "<url><loc>https://test-%d.com</loc></url>", i)
+			}
+			_, _ = io.WriteString(w, "</urlset>")
+		}
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "sitemap=true"},
+		Body:   io.NopCloser(strings.NewReader(srv.URL + "/index.xml")),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusBadGateway, w.Code)
+	}
+	if want := []string{"/index.xml", "/large.xml"}; strings.Join(requested, ",") != strings.Join(want, ",") {
+		t.Errorf("wrong requested sitemaps: want = %v, got = %v", want, requested)
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	net_url "net/url"
+	"syscall"
+)
+
+var (
+	errSourcesDisabled  = errors.New("list sources are not enabled")
+	errNotSingleSource  = errors.New("want a single source URL")
+	errSourceNotAllowed = errors.New("source URL is not allowed")
+	errNotPublicAddress = errors.New("address is not public")
+)
+
+// publicOnlyKey is a context key marking requests allowed to connect to public addresses only.
+type publicOnlyKey struct{}
+
+// getSourceList fetches a list of URLs separated by a new line from a single given source target
+// and returns targets of the listed URLs.
+//
+// Only http and https sources are fetched, and not of hosts out of the allowlist, nor are redirects to other schemes
+// followed. Connections of the source request and its redirects to loopback, private or link-local addresses
+// are refused by the dialer of the default client, whether the addresses are given literally or resolved. A source body larger than the maximum size
+// fails the fetch instead of being truncated.
+func (h *ResponseSizeCounter) getSourceList(ctx context.Context, sources []target) ([]target, error) {
+	if h.maxSourceSize == 0 {
+		return nil, errSourcesDisabled
+	}
+
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("%w, got %d", errNotSingleSource, len(sources))
+	}
+	url := sources[0].URL
+
+	if !isHTTPURL(url) || !h.allowedHosts.allows(url) {
+		return nil, fmt.Errorf("'%s': %w", url, errSourceNotAllowed)
+	}
+
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, publicOnlyKey{}, true), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("source '%s': %s", url, err)
+	}
+
+	res, err := h.getter().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("source '%s': %w", url, err)
+	}
+	defer closeResBody(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("source '%s': unexpected status %d", url, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, h.maxSourceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("source '%s': %s", url, err)
+	}
+
+	if int64(len(body)) > h.maxSourceSize {
+		return nil, fmt.Errorf("source '%s' is larger than %d bytes", url, h.maxSourceSize)
+	}
+
+	// texts of invalid lines are not echoed, as the source is not the client's to read
+	targets, err := h.parseTargets(string(body))
+	var invalid invalidLines
+	if errors.As(err, &invalid) {
+		return nil, fmt.Errorf("source '%s' has %d invalid lines, the first one is line %d", url, len(invalid), invalid[0].Line)
+	} else if err != nil {
+		return nil, fmt.Errorf("source '%s': %s", url, err)
+	}
+
+	return targets, nil
+}
+
+// isHTTPURL reports whether a given URL is an http or https one having a host.
+func isHTTPURL(url string) bool {
+	u, err := net_url.Parse(url)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	return u.Host != ""
+}
+
+// publicOnlyControl refuses connections to loopback, private, link-local or unspecified addresses
+// of requests marked with publicOnlyKey. It checks an address being connected to, so resolved names are covered.
+func publicOnlyControl(ctx context.Context, _, address string, _ syscall.RawConn) error {
+	if publicOnly, _ := ctx.Value(publicOnlyKey{}).(bool); !publicOnly {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("'%s': %w", host, errNotPublicAddress)
+	}
+
+	return nil
+}
+
+// sourceErrorStatus returns a response status for a given error of getting a source list.
+func sourceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errSourceNotAllowed), errors.Is(err, errNotPublicAddress):
+		return http.StatusForbidden
+	case errors.Is(err, errSourcesDisabled), errors.Is(err, errNotSingleSource):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
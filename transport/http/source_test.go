@@ -0,0 +1,230 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_source(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const source = "https://lists.example.com/urls.txt?sig=abc"
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo(source)).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("https://a.com\n\nhttps://b.com\n")),
+	}, nil)
+	client.EXPECT().Do(requestTo("https://a.com")).Return(response(http.StatusOK), nil)
+	client.EXPECT().Do(requestTo("https://b.com")).Return(response(http.StatusOK), nil)
+
+	handler := newResponseSizeCounter(t, WithListSources(1024))
+	handler.SetClient(client)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, sourceRequest(source))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != 2 || results[0].URL != "https://a.com" || results[1].URL != "https://b.com" {
+		t.Errorf("wrong results: %+v", results)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		opts   []Option
+		status int
+	}{
+		{name: "disabled", body: "https://lists.example.com", status: http.StatusBadRequest},
+		{name: "several", body: "https://a.com\nhttps://b.com", opts: []Option{WithListSources(1024)}, status: http.StatusBadRequest},
+		{name: "loopback", body: "http://127.0.0.1/urls.txt", opts: []Option{WithListSources(1024)}, status: http.StatusForbidden},
+		// a name is checked by the address it resolves to
+		{name: "localhost", body: "http://localhost:8080/urls.txt", opts: []Option{WithListSources(1024)}, status: http.StatusForbidden},
+		{name: "private", body: "http://10.0.0.1/urls.txt", opts: []Option{WithListSources(1024)}, status: http.StatusForbidden},
+		{name: "metadata", body: "http://169.254.169.254/latest", opts: []Option{WithListSources(1024)}, status: http.StatusForbidden},
+		{name: "ipv6 loopback", body: "http://[::1]/urls.txt", opts: []Option{WithListSources(1024)}, status: http.StatusForbidden},
+		{name: "scheme", body: "file:///etc/passwd", opts: []Option{WithListSources(1024), WithLocalFiles("/")}, status: http.StatusForbidden},
+		{
+			name:   "disallowed host",
+			body:   "https://lists.evil.com",
+			opts:   []Option{WithListSources(1024), WithAllowedHosts([]string{"*.example.com"})},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// the default client refuses to connect, so nothing is requested
+			handler := newResponseSizeCounter(t, tt.opts...)
+			handler.transport.Proxy = nil
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, sourceRequest(tt.body))
+
+			if w.Code != tt.status {
+				t.Errorf("wrong response status: want = %d, got = %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_largeSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(strings.Repeat("https://a.com\n", 10))),
+	}, nil)
+
+	handler := newResponseSizeCounter(t, WithListSources(100))
+	handler.SetClient(client)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, sourceRequest("https://lists.example.com"))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("wrong response status: want = %d, got = %d: %s", http.StatusBadGateway, w.Code, w.Body)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_sourceRedirect(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret-token-AAA\n"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	socket := filepath.Join(dir, "app.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("cannot listen on unix socket: %s", err)
+	}
+	unixSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("secret-token-BBB\n"))
+	}))
+	unixSrv.Listener = l
+	unixSrv.Start()
+	defer unixSrv.Close()
+
+	for name, location := range map[string]string{
+		"file": "file:///secret.txt",
+		"unix": "http+unix://localhost" + socket + ":/",
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.RedirectHandler(location, http.StatusFound))
+			defer srv.Close()
+
+			handler := newResponseSizeCounter(t, WithListSources(1024), WithLocalFiles(dir), WithUnixSockets([]string{socket}))
+			handler.transport.Proxy = nil
+			// the source is served as if it had a public address
+			handler.transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, srv.Listener.Addr().String())
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, sourceRequest("http://192.0.2.2/urls.txt"))
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("wrong response status: want = %d, got = %d: %s", http.StatusForbidden, w.Code, w.Body)
+			}
+			if strings.Contains(w.Body.String(), "secret-token") {
+				t.Errorf("redirect target is read: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_invalidSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("https://a.com\nsecret-token-AAA\n")),
+	}, nil)
+
+	handler := newResponseSizeCounter(t, WithListSources(1024))
+	handler.SetClient(client)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, sourceRequest("https://lists.example.com/urls.txt"))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("wrong response status: want = %d, got = %d: %s", http.StatusBadGateway, w.Code, w.Body)
+	}
+	if body := w.Body.String(); strings.Contains(body, "secret-token") || !strings.Contains(body, "line 2") {
+		t.Errorf("wrong response body: %s", body)
+	}
+}
+
+func sourceRequest(body string) *http.Request {
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "source=true&format=json"},
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func Test_publicOnlyControl(t *testing.T) {
+	publicOnly := context.WithValue(context.Background(), publicOnlyKey{}, true)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		address string
+		allowed bool
+	}{
+		{name: "public", ctx: publicOnly, address: "93.184.216.34:443", allowed: true},
+		{name: "public ipv6", ctx: publicOnly, address: "[2606:2800:220:1::]:443", allowed: true},
+		{name: "loopback", ctx: publicOnly, address: "127.0.0.1:80"},
+		{name: "private", ctx: publicOnly, address: "192.168.1.1:80"},
+		{name: "link-local", ctx: publicOnly, address: "169.254.169.254:80"},
+		{name: "unspecified", ctx: publicOnly, address: "0.0.0.0:80"},
+		{name: "ipv6 unique local", ctx: publicOnly, address: "[fd00::1]:80"},
+		{name: "not marked", ctx: context.Background(), address: "127.0.0.1:80", allowed: true},
+	}
+
+	for _, tt := range tests {
+		err := publicOnlyControl(tt.ctx, "tcp", tt.address, nil)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s: wrong check of %s: want allowed = %t, got = %v", tt.name, tt.address, tt.allowed, err)
+		}
+		if err != nil && !errors.Is(err, errNotPublicAddress) {
+			t.Errorf("%s: wrong error: want = %v, got = %v", tt.name, errNotPublicAddress, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// spillFile is a resultSource of results spilled to a temporary file as JSON lines.
+//
+// Results are appended as they are fetched, while an index of their lines makes them read back
+// in the order of their URLs within a request.
+type spillFile struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	err error
+
+	// size is a number of bytes written to the file so far.
+	size int64
+	// lines holds a span of a line of each result by its order, a zero one if the result is missing.
+	lines []spillLine
+}
+
+// spillLine is a span of a single line of a spill file.
+type spillLine struct {
+	offset int64
+	length int
+}
+
+// spillRecord is a line of a spill file, it keeps unexported fields of a result as well.
+type spillRecord struct {
+	Order  int    `json:"order"`
+	Status int    `json:"status"`
+	Result Result `json:"result"`
+}
+
+func newSpillFile(dir string, results int) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "results-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillFile{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		lines: make([]spillLine, results),
+	}, nil
+}
+
+// add appends a given result to the file. The first write error is reported by each.
+func (sf *spillFile) add(res Result) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.err != nil {
+		return
+	}
+
+	b, err := json.Marshal(spillRecord{Order: res.order, Status: res.status, Result: res})
+	if err != nil {
+		sf.err = err
+		return
+	}
+
+	if _, sf.err = sf.w.Write(append(b, '\n')); sf.err != nil {
+		return
+	}
+
+	sf.lines[res.order] = spillLine{offset: sf.size, length: len(b)}
+	sf.size += int64(len(b) + 1)
+}
+
+// each reads results back in the order of their URLs within a request.
+func (sf *spillFile) each(fn func(res Result) error) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.err != nil {
+		return fmt.Errorf("spill result: %s", sf.err)
+	}
+
+	if err := sf.w.Flush(); err != nil {
+		return fmt.Errorf("flush spilled results: %s", err)
+	}
+
+	var buf []byte
+	for _, line := range sf.lines {
+		if line.length == 0 {
+			continue
+		}
+
+		if cap(buf) < line.length {
+			buf = make([]byte, line.length)
+		}
+		buf = buf[:line.length]
+
+		if _, err := sf.f.ReadAt(buf, line.offset); err != nil {
+			return fmt.Errorf("read spilled result: %s", err)
+		}
+
+		var rec spillRecord
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return fmt.Errorf("decode spilled result: %s", err)
+		}
+
+		res := rec.Result
+		res.order, res.status = rec.Order, rec.Status
+
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes and removes the file.
+func (sf *spillFile) close() error {
+	closeErr := sf.f.Close()
+	if err := os.Remove(sf.f.Name()); err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// getSpilledRespSizes fetches given targets spilling their results to a temporary file.
+// The file is removed if fetching fails, otherwise it has to be closed by a caller.
+func (h *ResponseSizeCounter) getSpilledRespSizes(ctx context.Context, targets []target, p params) (*spillFile, error) {
+	sf, err := newSpillFile(h.spillDir, len(targets))
+	if err != nil {
+		return nil, fmt.Errorf("create spill file: %s", err)
+	}
+
+	if err := h.fetchAll(ctx, targets, p, sf.add); err != nil {
+		closeSpillFile(sf)
+		return nil, err
+	}
+
+	return sf, nil
+}
+
+func closeSpillFile(sf *spillFile) {
+	if err := sf.close(); err != nil {
+		log.Printf("close spill file: %s", err)
+	}
+}
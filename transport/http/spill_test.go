@@ -0,0 +1,128 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestWithDiskSpill(t *testing.T) {
+	const urls = 1000
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		// a body of each response is a host of a requested URL
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+			}, nil
+		}).Times(urls)
+	}
+
+	dir := t.TempDir()
+
+	handler := newResponseSizeCounter(t, WithDiskSpill(dir))
+	handler.client = client
+
+	req := streamRequest(urls)
+	req.URL = &net_url.URL{RawQuery: "format=json"}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	var results []Result
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(results) != urls {
+		t.Fatalf("results count: want = %d, got = %d", urls, len(results))
+	}
+
+	seen := make(map[string]bool)
+	for _, result := range results {
+		u, err := net_url.Parse(result.URL)
+		if err != nil {
+			t.Fatalf("wrong result url: %s", err)
+		}
+
+		if result.Size != len(u.Host) {
+			t.Errorf("wrong size of %s: want = %d, got = %d", result.URL, len(u.Host), result.Size)
+		}
+
+		seen[result.URL] = true
+	}
+
+	if len(seen) != urls {
+		t.Errorf("distinct results count: want = %d, got = %d", urls, len(seen))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("cannot read spill directory: %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("spill file is not removed: %d entries left", len(entries))
+	}
+}
+
+func TestWithDiskSpill_order(t *testing.T) {
+	const urls = 6
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		// a status of each response tells a position of a requested URL
+		for i := 0; i < urls; i++ {
+			client.EXPECT().Do(requestTo(fmt.Sprintf("https://test-%d.com", i))).Return(response(http.StatusOK+i), nil)
+		}
+	}
+
+	handler := newResponseSizeCounter(t,
+		WithDiskSpill(t.TempDir()), WithShuffleSeed(1), WithMaxConcurrentFetches(1))
+	handler.client = client
+
+	req := streamRequest(urls)
+	req.URL = &net_url.URL{RawQuery: "format=csv&fields=url,status"}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	want := "url,status\n"
+	for i := 0; i < urls; i++ {
+		want += fmt.Sprintf("https://test-%d.com,%d\n", i, http.StatusOK+i)
+	}
+
+	if got := w.Body.String(); got != want {
+		t.Errorf("wrong response body: want = %q, got = %q", want, got)
+	}
+}
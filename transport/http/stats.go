@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// statsPath is a path MakeResponseSizeCounter serves StatsHandler at.
+const statsPath = "/stats"
+
+// Stats holds lifetime statistics of a handler.
+type Stats struct {
+	// Uptime is a time passed since the handler is created.
+	Uptime time.Duration
+	// Requests is a number of requests the handler served, whatever their methods and outcomes are.
+	Requests int64
+}
+
+// Stats returns lifetime statistics of the handler.
+func (h *ResponseSizeCounter) Stats() Stats {
+	var uptime time.Duration
+	if !h.started.IsZero() {
+		uptime = time.Since(h.started)
+	}
+
+	return Stats{
+		Uptime:   uptime,
+		Requests: atomic.LoadInt64(&h.metrics.requests),
+	}
+}
+
+// StatsHandler returns a handler responding to GET requests with lifetime statistics of the handler
+// as a JSON object, e.g. {"uptime_seconds": 3600.5, "requests": 42}.
+func (h *ResponseSizeCounter) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET method supported.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		stats := h.Stats()
+
+		w.Header().Set("Content-Type", jsonFormat.contentType)
+
+		_ = json.NewEncoder(w).Encode(struct {
+			UptimeSeconds float64 `json:"uptime_seconds"`
+			Requests      int64   `json:"requests"`
+		}{stats.Uptime.Seconds(), stats.Requests})
+	})
+}
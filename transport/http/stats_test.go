@@ -0,0 +1,74 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseSizeCounter_Stats(t *testing.T) {
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(StaticGetter{Size: 1})
+
+	// requests of any method and outcome are counted
+	requests := []*http.Request{
+		LoadTestRequest(3, ""),
+		LoadTestRequest(3, "slowest=-1"),
+		httptest.NewRequest(http.MethodGet, "/", nil),
+	}
+	for i, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := handler.Stats().Requests; got != int64(i+1) {
+			t.Errorf("wrong number of requests: want = %d, got = %d", i+1, got)
+		}
+	}
+
+	if handler.Stats().Uptime <= 0 {
+		t.Errorf("uptime is not positive: %s", handler.Stats().Uptime)
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.StatsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, statsPath, nil))
+
+	var got struct {
+		UptimeSeconds float64 `json:"uptime_seconds"`
+		Requests      int64   `json:"requests"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if got.Requests != 3 || got.UptimeSeconds <= 0 {
+		t.Errorf("wrong stats: %+v", got)
+	}
+}
+
+func TestMakeResponseSizeCounter_stats(t *testing.T) {
+	handler := MakeResponseSizeCounter()
+
+	// requests of every route are counted once
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, versionPath, nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, statsPath, nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != jsonFormat.contentType {
+		t.Fatalf("stats are not served: status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var got struct {
+		Requests int64 `json:"requests"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if got.Requests != 3 {
+		t.Errorf("wrong number of requests: want = %d, got = %d", 3, got.Requests)
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultStreamBuffer = 16
+
+// stream writes results to a client as NDJSON as soon as URLs are fetched.
+//
+// Fetches are performed by as many workers as the stream buffer holds, so a slow client
+// pauses fetching instead of making results pile up in memory.
+// Remaining fetches are cancelled once writing a result fails or the request context is done.
+// A write to a client which stops reading fails after the stream idle timeout, if set.
+// Results are spaced out by the stream rate of the request, if any, fetches pause as the buffer fills then.
+func (h *ResponseSizeCounter) stream(w http.ResponseWriter, req *http.Request, targets []target, p params) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	results := make(chan Result, h.streamWorkers())
+	go func() {
+		defer close(results)
+		h.fetchTo(ctx, targets, results, p)
+	}()
+
+	w.Header().Set("Content-Type", ndjsonFormat.contentType)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	var rc *http.ResponseController
+	if h.streamIdleTimeout > 0 {
+		rc = http.NewResponseController(w)
+		defer func() { _ = rc.SetWriteDeadline(time.Time{}) }()
+	}
+
+	pace := pacer{interval: p.streamRate}
+
+	failed := false
+	for res := range results {
+		// the client is gone, remaining results are drained while workers stop
+		if failed {
+			continue
+		}
+
+		if !pace.wait(ctx) {
+			failed = true
+			continue
+		}
+
+		if rc != nil {
+			// writers not supporting deadlines are written to without them
+			_ = rc.SetWriteDeadline(time.Now().Add(h.streamIdleTimeout))
+		}
+
+		if err := enc.Encode(res); err != nil {
+			log.Printf("stream result: client disconnected: %s", err)
+			failed = true
+			cancel()
+			continue
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := req.Context().Err(); err != nil {
+		log.Printf("stream results: client disconnected: %s", err)
+	}
+}
+
+// pacer spaces out streamed results by an interval, if set.
+type pacer struct {
+	interval time.Duration
+	last     time.Time
+}
+
+// wait blocks till the interval passes since the previous result is emitted, if any.
+// It returns false if a given context is done first.
+func (p *pacer) wait(ctx context.Context) bool {
+	if p.interval > 0 && !p.last.IsZero() {
+		timer := time.NewTimer(time.Until(p.last.Add(p.interval)))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	p.last = time.Now()
+
+	return true
+}
+
+// streamWorkers returns a number of workers fetching URLs of a streamed request,
+// which is the stream buffer size unless adaptive concurrency lowers it.
+func (h *ResponseSizeCounter) streamWorkers() int {
+	workers := h.streamBuffer
+	if h.adaptive != nil {
+		if limit := h.adaptive.limit(); limit < workers {
+			workers = limit
+		}
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	return workers
+}
+
+// fetchTo fetches given targets by as many workers as out capacity is, sending results to out.
+//
+// It returns when every worker is done, which happens early if ctx is cancelled.
+func (h *ResponseSizeCounter) fetchTo(ctx context.Context, targets []target, out chan<- Result, p params) {
+	queue := make(chan target)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cap(out); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for t := range queue {
+				result, err := h.fetch(ctx, t, p)
+				if err != nil {
+					result.Error = err.Error()
+				}
+
+				select {
+				case out <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, i := range h.fetchOrder(len(targets)) {
+		select {
+		case queue <- targets[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+
+	wg.Wait()
+}
@@ -0,0 +1,353 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_stream_backpressure(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		lines  int
+	}{
+		{name: "slow client", cancel: false, lines: 10},
+		{name: "cancelled request", cancel: true, lines: 2},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var gets int32
+
+			client := http_mock.NewMockClient(ctrl)
+			{
+				client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+					atomic.AddInt32(&gets, 1)
+					return response(http.StatusOK), nil
+				}).AnyTimes()
+			}
+
+			handler := &ResponseSizeCounter{
+				client:       client,
+				streamBuffer: 1,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req := streamRequest(10).WithContext(ctx)
+			w := &blockingWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan struct{})}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(w, req)
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+
+			// one result is being written, one is buffered and one is waiting for the buffer
+			if got := atomic.LoadInt32(&gets); got != 3 {
+				t.Errorf("fetches while client is blocked: want = %d, got = %d", 3, got)
+			}
+
+			if tt.cancel {
+				cancel()
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			close(w.release)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("stream is not finished")
+			}
+
+			if got := strings.Count(w.Body.String(), "\n"); got != tt.lines {
+				t.Errorf("streamed results count: want = %d, got = %d", tt.lines, got)
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_stream_writeFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var gets int32
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&gets, 1)
+		time.Sleep(5 * time.Millisecond)
+		return response(http.StatusOK), nil
+	}).AnyTimes()
+
+	handler := &ResponseSizeCounter{
+		client:       client,
+		streamBuffer: 1,
+	}
+
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder(), writes: 1}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, streamRequest(50))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream is not finished")
+	}
+
+	// the failing write cancels fetches, one may be in flight and one buffered at that moment
+	if got := atomic.LoadInt32(&gets); got > 4 {
+		t.Errorf("fetches after write failure: want at most %d, got = %d", 4, got)
+	}
+
+	if got := atomic.LoadInt32(&w.attempts); got != 2 {
+		t.Errorf("writes after write failure: want = %d, got = %d", 2, got)
+	}
+}
+
+// failingWriter is a http.ResponseWriter failing writes after a number of successful ones.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes   int32
+	attempts int32
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if atomic.AddInt32(&w.attempts, 1) > w.writes {
+		return 0, errors.New("broken pipe")
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+// blockingWriter is a http.ResponseWriter blocking writes until released.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestResponseSizeCounter_stream_idleTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	handler := newResponseSizeCounter(t, WithStreamIdleTimeout(timeout), WithStreamBuffer(1))
+	handler.SetClient(StaticGetter{Size: 1})
+
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	// results of long URLs overflow socket buffers of a client which never reads them
+	var body strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&body, "https://test.com/%d/%s\n", i, strings.Repeat("a", 16*1024))
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("cannot connect: %s", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.(*net.TCPConn).SetReadBuffer(1024); err != nil {
+		t.Fatalf("cannot shrink read buffer: %s", err)
+	}
+
+	_, err = fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: test\r\nAccept: application/x-ndjson\r\nContent-Length: %d\r\n\r\n%s",
+		body.Len(), body.String())
+	if err != nil {
+		t.Fatalf("cannot send request: %s", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream to stalled client is not closed")
+	}
+}
+
+// timingWriter records a time of each write.
+type timingWriter struct {
+	*httptest.ResponseRecorder
+	writes []time.Time
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, time.Now())
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestResponseSizeCounter_stream_rate(t *testing.T) {
+	const interval = 50 * time.Millisecond
+
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(StaticGetter{Size: 1})
+
+	req := streamRequest(4)
+	req.URL = &net_url.URL{RawQuery: "stream_rate=" + interval.String()}
+
+	w := &timingWriter{ResponseRecorder: httptest.NewRecorder()}
+
+	handler.ServeHTTP(w, req)
+
+	if lines := strings.Count(w.Body.String(), "\n"); lines != 4 {
+		t.Fatalf("wrong number of streamed results: want = %d, got = %d", 4, lines)
+	}
+
+	for i := 1; i < len(w.writes); i++ {
+		// a timer never fires early, the tolerance covers encoding of a result only
+		if gap := w.writes[i].Sub(w.writes[i-1]); gap < interval-5*time.Millisecond || gap > 3*interval {
+			t.Errorf("wrong spacing of result #%d: want = %s, got = %s", i, interval, gap)
+		}
+	}
+}
+
+func TestResponseSizeCounter_stream_rateCancelled(t *testing.T) {
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(StaticGetter{Size: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := streamRequest(4).WithContext(ctx)
+	req.URL = &net_url.URL{RawQuery: "stream_rate=1h"}
+
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, req)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("paced stream is not stopped by cancellation")
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongStreamRate(t *testing.T) {
+	for _, rate := range []string{"soon", "0s", "-1s"} {
+		req := streamRequest(1)
+		req.URL = &net_url.URL{RawQuery: "stream_rate=" + rate}
+
+		w := httptest.NewRecorder()
+
+		(&ResponseSizeCounter{client: StaticGetter{Size: 1}}).ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong response status of stream rate '%s': want = %d, got = %d", rate, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestResponseSizeCounter_stream_gzip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	release := make(chan struct{})
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-0.com")).Return(response(http.StatusOK), nil)
+		client.EXPECT().Do(requestTo("https://test-1.com")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			<-release
+			return response(http.StatusOK), nil
+		})
+	}
+
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(client)
+
+	srv := httptest.NewServer(Gzip(gzip.DefaultCompression)(handler))
+	defer srv.Close()
+
+	req := streamRequest(2)
+	req.URL, _ = net_url.Parse(srv.URL)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	defer close(release)
+
+	line := make(chan string, 1)
+	go func() {
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			line <- err.Error()
+			return
+		}
+		defer closeResBody(res.Body)
+
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			line <- err.Error()
+			return
+		}
+
+		l, _ := bufio.NewReader(zr).ReadString('\n')
+		line <- l
+	}()
+
+	// the second result is held back until the first one is read, so it arrives only if flushed
+	select {
+	case l := <-line:
+		if !strings.Contains(l, "https://test-0.com") {
+			t.Errorf("wrong first line: %q", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first result is not flushed through gzip")
+	}
+}
+
+func streamRequest(urls int) *http.Request {
+	body := &bytes.Buffer{}
+	for i := 0; i < urls; i++ {
+		fmt.Fprintf(body, "https://test-%d.com\n", i)
+	}
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{"Accept": []string{"application/x-ndjson"}},
+		Body:   io.NopCloser(body),
+	}
+
+	return req
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Summary holds aggregate statistics of sizes of fetched URLs.
+//
+// Sizes of skipped and failed URLs are not taken into account, failures are counted by their class instead.
+type Summary struct {
+	// Count is a number of fetched URLs, Total, Min, Max and Avg are of their sizes.
+	Count int     `json:"count"`
+	Total int     `json:"total"`
+	Min   int     `json:"min"`
+	Max   int     `json:"max"`
+	Avg   float64 `json:"avg"`
+
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P99 int `json:"p99"`
+
+	// ConnectionCounts sums connections of all URLs, failed ones included, set if tracing is enabled.
+	*ConnectionCounts
+
+	// Errors counts failed fetches by their class, set if there are any.
+	Errors *ErrorCounts `json:"errors,omitempty"`
+}
+
+// ConnectionCounts holds numbers of connections opened and reused to fetch URLs.
+type ConnectionCounts struct {
+	New    int `json:"connections_new"`
+	Reused int `json:"connections_reused"`
+}
+
+// summarize computes a Summary of given results.
+func summarize(results resultSource) (Summary, error) {
+	sizes := make([]int, 0)
+	var conns *ConnectionCounts
+	var errs *ErrorCounts
+
+	err := results.each(func(res Result) error {
+		if res.ConnectionCounts != nil {
+			if conns == nil {
+				conns = &ConnectionCounts{}
+			}
+			conns.New += res.New
+			conns.Reused += res.Reused
+		}
+
+		if res.ErrorClass != "" {
+			if errs == nil {
+				errs = &ErrorCounts{}
+			}
+			errs.add(res.ErrorClass)
+		}
+
+		if res.Skipped == "" && res.Error == "" {
+			sizes = append(sizes, res.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	sort.Ints(sizes)
+
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	s := Summary{
+		Count:            len(sizes),
+		Total:            total,
+		P50:              percentile(sizes, 50),
+		P90:              percentile(sizes, 90),
+		P99:              percentile(sizes, 99),
+		ConnectionCounts: conns,
+		Errors:           errs,
+	}
+
+	if len(sizes) > 0 {
+		s.Min = sizes[0]
+		s.Max = sizes[len(sizes)-1]
+		s.Avg = float64(total) / float64(len(sizes))
+	}
+
+	return s, nil
+}
+
+// setHeaders sets the summary to response headers.
+func (s Summary) setHeaders(h http.Header) {
+	h.Set("X-Size-P50", strconv.Itoa(s.P50))
+	h.Set("X-Size-P90", strconv.Itoa(s.P90))
+	h.Set("X-Size-P99", strconv.Itoa(s.P99))
+
+	if s.ConnectionCounts != nil {
+		h.Set("X-Connections-New", strconv.Itoa(s.New))
+		h.Set("X-Connections-Reused", strconv.Itoa(s.Reused))
+	}
+
+	if s.Errors != nil {
+		h.Set("X-Errors", s.Errors.String())
+	}
+}
+
+// summaryFormat is a format writing a given summary as a JSON object instead of results.
+func summaryFormat(s Summary) format {
+	return format{
+		contentType: jsonFormat.contentType,
+		write: func(w io.Writer, _ resultSource) error {
+			return json.NewEncoder(w).Encode(s)
+		},
+	}
+}
+
+// percentile returns a p-th percentile of given sorted sizes by nearest-rank method, zero if there are no sizes.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
@@ -0,0 +1,282 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestPercentile(t *testing.T) {
+	sizes := make([]int, 0, 100)
+	for i := 1; i <= 100; i++ {
+		sizes = append(sizes, i)
+	}
+
+	tests := []struct {
+		sizes []int
+		p     float64
+		want  int
+	}{
+		{sizes: sizes, p: 50, want: 50},
+		{sizes: sizes, p: 90, want: 90},
+		{sizes: sizes, p: 99, want: 99},
+		{sizes: []int{7}, p: 50, want: 7},
+		{sizes: []int{1, 2, 3, 4}, p: 50, want: 2},
+		{sizes: []int{1, 2, 3, 4}, p: 99, want: 4},
+		{sizes: nil, p: 50, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.sizes, tt.p); got != tt.want {
+			t.Errorf("wrong p%v of %d sizes: want = %d, got = %d", tt.p, len(tt.sizes), tt.want, got)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_summary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		// https://test-<i>.com responds with a body of (i+1)*10 bytes
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			i, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(req.URL.Host, "test-"), ".com"))
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(strings.Repeat("0", (i+1)*10))),
+			}, nil
+		}).Times(10)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := streamRequest(10)
+	req.URL = &net_url.URL{RawQuery: "summary=true&format=json"}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	want := Summary{Count: 10, Total: 550, Min: 10, Max: 100, Avg: 55, P50: 50, P90: 90, P99: 100}
+
+	var body struct {
+		Results []Result `json:"results"`
+		Summary Summary  `json:"summary"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	if len(body.Results) != 10 {
+		t.Errorf("results count: want = %d, got = %d", 10, len(body.Results))
+	}
+
+	if body.Summary != want {
+		t.Errorf("wrong summary: want = %+v, got = %+v", want, body.Summary)
+	}
+
+	headers := map[string]int{"X-Size-P50": want.P50, "X-Size-P90": want.P90, "X-Size-P99": want.P99}
+	for header, value := range headers {
+		if got := res.Header.Get(header); got != strconv.Itoa(value) {
+			t.Errorf("wrong %s header: want = %d, got = %s", header, value, got)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_aggregateOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		// https://test-<i>.com responds with a body of (i+1)*10 bytes, https://test-3.com fails
+		client.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			i, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(req.URL.Host, "test-"), ".com"))
+			if i == 3 {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(strings.Repeat("0", (i+1)*10))),
+			}, nil
+		}).Times(3 * 4)
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	for _, format := range []string{"json", "ndjson", "text"} {
+		req := streamRequest(4)
+		req.URL = &net_url.URL{RawQuery: "aggregate=only&format=" + format}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: wrong response status: want = %d, got = %d", format, http.StatusOK, w.Code)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: cannot decode response body: %s", format, err)
+		}
+
+		if _, ok := body["results"]; ok || strings.Contains(w.Body.String(), "test-") {
+			t.Errorf("%s: response holds per-URL data: %s", format, w.Body)
+		}
+
+		var got Summary
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: cannot decode summary: %s", format, err)
+		}
+
+		want := Summary{Count: 3, Total: 60, Min: 10, Max: 30, Avg: 20, P50: 20, P90: 30, P99: 30, Errors: &ErrorCounts{Other: 1}}
+		if got.Errors == nil || *got.Errors != *want.Errors {
+			t.Errorf("%s: wrong errors: want = %+v, got = %+v", format, want.Errors, got.Errors)
+		}
+
+		got.Errors, want.Errors = nil, nil
+		if got != want {
+			t.Errorf("%s: wrong summary: want = %+v, got = %+v", format, want, got)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_connectionsSummary(t *testing.T) {
+	var accepted int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&accepted, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// fetches one by one reuse a single kept-alive connection
+	handler := newResponseSizeCounter(t, WithConnectionTracing(), WithMaxConcurrentFetches(1))
+
+	urls := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", srv.URL, i))
+	}
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "summary=true&format=json"},
+		Body:   io.NopCloser(strings.NewReader(strings.Join(urls, "\n"))),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var body struct {
+		Results []Result `json:"results"`
+		Summary Summary  `json:"summary"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	want := ConnectionCounts{New: int(atomic.LoadInt32(&accepted)), Reused: 5 - int(atomic.LoadInt32(&accepted))}
+	if want.New != 1 {
+		t.Errorf("wrong number of accepted connections: want = %d, got = %d", 1, want.New)
+	}
+
+	if body.Summary.ConnectionCounts == nil || *body.Summary.ConnectionCounts != want {
+		t.Errorf("wrong connections summary: want = %+v, got = %+v", want, body.Summary.ConnectionCounts)
+	}
+
+	for _, res := range body.Results {
+		if res.ConnectionCounts == nil || res.New+res.Reused != 1 {
+			t.Errorf("wrong connections of %s: %+v", res.URL, res.ConnectionCounts)
+		}
+	}
+
+	headers := map[string]int{"X-Connections-New": want.New, "X-Connections-Reused": want.Reused}
+	for header, value := range headers {
+		if got := w.Header().Get(header); got != strconv.Itoa(value) {
+			t.Errorf("wrong %s header: want = %d, got = %s", header, value, got)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_errorsSummary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(requestTo("https://ok.com")).Return(response(http.StatusOK), nil)
+	client.EXPECT().Do(requestTo("https://slow-1.com")).Return(nil, context.DeadlineExceeded)
+	client.EXPECT().Do(requestTo("https://slow-2.com")).Return(nil, context.DeadlineExceeded)
+	client.EXPECT().Do(requestTo("https://slow-3.com")).Return(nil, context.DeadlineExceeded)
+	client.EXPECT().Do(requestTo("https://missing.com")).Return(nil, &net.DNSError{Err: "no such host", Name: "missing.com"})
+	client.EXPECT().Do(requestTo("https://down-1.com")).Return(response(http.StatusBadGateway), nil)
+	client.EXPECT().Do(requestTo("https://down-2.com")).Return(response(http.StatusServiceUnavailable), nil)
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &net_url.URL{RawQuery: "summary=true&format=json"},
+		Body: io.NopCloser(strings.NewReader(strings.Join([]string{
+			"https://ok.com", "https://slow-1.com", "https://slow-2.com", "https://slow-3.com",
+			"https://missing.com", "https://down-1.com", "https://down-2.com",
+		}, "\n"))),
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var body struct {
+		Results []Result `json:"results"`
+		Summary Summary  `json:"summary"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	want := ErrorCounts{Timeout: 3, DNS: 1, HTTP5xx: 2}
+	if body.Summary.Errors == nil || *body.Summary.Errors != want {
+		t.Errorf("wrong errors summary: want = %+v, got = %+v", want, body.Summary.Errors)
+	}
+
+	if got := w.Header().Get("X-Errors"); got != "timeout=3, dns=1, http_5xx=2" {
+		t.Errorf("wrong X-Errors header: %s", got)
+	}
+
+	if body.Results[0].ErrorClass != "" || body.Results[1].ErrorClass != errorClassTimeout {
+		t.Errorf("wrong error classes of results: %+v", body.Results[:2])
+	}
+}
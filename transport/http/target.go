@@ -0,0 +1,136 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// target is a URL to be measured along with an outbound request to perform.
+type target struct {
+	URL string `json:"url"`
+
+	// Method is a method of the outbound request, GET if empty.
+	Method string `json:"method,omitempty"`
+	// Body is a body of the outbound request, none if empty.
+	Body string `json:"body,omitempty"`
+	// ContentType is a content type of the body, none if empty.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Expect is a size the URL is expected to respond with, the size is not checked if nil.
+	Expect *int `json:"expect,omitempty"`
+
+	// Timeout overrides a time limit of fetching the URL, e.g. "30s".
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// newRequest builds an outbound request to the target URL.
+func (t target) newRequest(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+	if t.Body != "" {
+		body = strings.NewReader(t.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.method(), t.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.ContentType != "" {
+		req.Header.Set("Content-Type", t.ContentType)
+	}
+
+	return req, nil
+}
+
+// method returns a method of the outbound request.
+func (t target) method() string {
+	if t.Method == "" {
+		return http.MethodGet
+	}
+
+	return t.Method
+}
+
+// timeout returns a time limit of fetching the URL, zero if the target doesn't override it.
+func (t target) timeout() (time.Duration, error) {
+	if t.Timeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(t.Timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("'%s' is not positive", t.Timeout)
+	}
+
+	return timeout, nil
+}
+
+// urlTargets returns targets performing GET requests to given URLs.
+func urlTargets(urls []string) []target {
+	targets := make([]target, 0, len(urls))
+	for _, url := range urls {
+		targets = append(targets, target{URL: url})
+	}
+
+	return targets
+}
+
+// errMalformedTargets fails requests having structured input which is not valid JSON or holds invalid targets.
+var errMalformedTargets = errors.New("malformed structured input")
+
+// decodeTargets decodes either a JSON array of targets or a JSON object of a target template and validates the targets.
+func decodeTargets(r io.Reader) ([]target, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: decode targets: %w", errMalformedTargets, err)
+	}
+
+	targets := make([]target, 0)
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		var tt targetTemplate
+		if err := json.Unmarshal(raw, &tt); err != nil {
+			return nil, fmt.Errorf("%w: decode target template: %w", errMalformedTargets, err)
+		}
+
+		var err error
+		if targets, err = tt.targets(); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(raw, &targets); err != nil {
+		return nil, fmt.Errorf("%w: decode targets: %w", errMalformedTargets, err)
+	}
+
+	for _, t := range targets {
+		if !isUrl(t.URL) {
+			return nil, fmt.Errorf("%w: '%s' is not a URL", errMalformedTargets, t.URL)
+		}
+
+		if _, err := t.newRequest(context.Background()); err != nil {
+			return nil, fmt.Errorf("%w: '%s' is not a valid request: %s", errMalformedTargets, t.URL, err)
+		}
+
+		if _, err := t.timeout(); err != nil {
+			return nil, fmt.Errorf("%w: '%s' has invalid timeout: %s", errMalformedTargets, t.URL, err)
+		}
+	}
+
+	return targets, nil
+}
+
+// isJSON reports whether a given request has a JSON body.
+func isJSON(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
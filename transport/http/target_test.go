@@ -0,0 +1,265 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_structuredInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const query = `{"query": "{ items { id } }"}`
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-1.com/graphql")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodPost {
+				t.Errorf("wrong request method: want = %s, got = %s", http.MethodPost, req.Method)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Errorf("cannot read request body: %s", err)
+			}
+
+			if string(body) != query {
+				t.Errorf("wrong request body: want = %s, got = %s", query, string(body))
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"data": {"items": [{"id": 1}]}}`)),
+			}, nil
+		})
+		client.EXPECT().Do(requestTo("https://test-2.com")).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet {
+				t.Errorf("wrong request method: want = %s, got = %s", http.MethodGet, req.Method)
+			}
+
+			return response(http.StatusOK), nil
+		})
+	}
+
+	handler := &ResponseSizeCounter{
+		client: client,
+	}
+
+	body := `[
+		{"url": "https://test-1.com/graphql", "method": "POST", "body": "{\"query\": \"{ items { id } }\"}"},
+		{"url": "https://test-2.com"}
+	]`
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, structuredRequest(body))
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, res.StatusCode)
+	}
+	defer closeResBody(res.Body)
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("cannot read response body: %s", err)
+	}
+
+	sizes := strings.Split(string(resBody), "\n")
+	if len(sizes) != 2 || !(sizes[0] == "32" && sizes[1] == "25000" || sizes[0] == "25000" && sizes[1] == "32") {
+		t.Errorf("wrong response sizes: want = [32 25000] in any order, got = %v", sizes)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongStructuredInput(t *testing.T) {
+	for _, body := range []string{
+		`https://test-1.com`,
+		`[{"url": "test-1.xyz"}]`,
+		`[{"url": "https://test-1.com", "method": "GET POST"}]`,
+		`[{"url": "https://test-1.com", "timeout": "soon"}]`,
+		`[{"url": "https://test-1.com", "timeout": "-1s"}]`,
+	} {
+		ctrl := gomock.NewController(t)
+
+		handler := &ResponseSizeCounter{
+			client: http_mock.NewMockClient(ctrl),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, structuredRequest(body))
+
+		if res := w.Result(); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("wrong structured input '%s' handled incorrectly: status = %d", body, res.StatusCode)
+		}
+
+		ctrl.Finish()
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_structuredTimeout(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithFetchTimeout(delay/5, 5*delay))
+
+	body := fmt.Sprintf(`[
+		{"url": "%[1]s/default"},
+		{"url": "%[1]s/longer", "timeout": "%[2]s"},
+		{"url": "%[1]s/clamped", "timeout": "1h"}
+	]`, srv.URL, 3*delay)
+
+	req := structuredRequest(body)
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	for _, res := range results {
+		succeeded := res.Error == "" && res.Size == 4
+		if wantSuccess := !strings.HasSuffix(res.URL, "/default"); succeeded != wantSuccess {
+			t.Errorf("wrong result of %s: want success = %t, got = %+v", res.URL, wantSuccess, res)
+		}
+	}
+
+	if len(results) != 3 {
+		t.Errorf("wrong number of results: want = %d, got = %d", 3, len(results))
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_expectedSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   int
+	}{
+		{
+			name: "matching",
+			body: `[{"url": "https://test-1.com", "expect": 25000}, {"url": "https://test-2.com"}]`,
+			want: http.StatusOK,
+		},
+		{
+			name:   "matching, mismatch status",
+			body:   `[{"url": "https://test-1.com", "expect": 25000}, {"url": "https://test-2.com"}]`,
+			status: http.StatusConflict,
+			want:   http.StatusOK,
+		},
+		{
+			name: "mismatching",
+			body: `[{"url": "https://test-1.com", "expect": 25000}, {"url": "https://test-2.com", "expect": 100}]`,
+			want: http.StatusOK,
+		},
+		{
+			name:   "mismatching, mismatch status",
+			body:   `[{"url": "https://test-1.com", "expect": 25000}, {"url": "https://test-2.com", "expect": 100}]`,
+			status: http.StatusConflict,
+			want:   http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := http_mock.NewMockClient(ctrl)
+			client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+				return response(http.StatusOK), nil
+			}).Times(2)
+
+			handler := &ResponseSizeCounter{
+				client:         client,
+				mismatchStatus: tt.status,
+			}
+
+			req := structuredRequest(tt.body)
+			req.Header.Set("Accept", "application/json")
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("wrong response status: want = %d, got = %d", tt.want, w.Code)
+			}
+
+			var results []Result
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("cannot decode response body: %s", err)
+			}
+
+			var expects []struct {
+				Expect *int `json:"expect"`
+			}
+			if err := json.Unmarshal([]byte(tt.body), &expects); err != nil {
+				t.Fatalf("cannot decode request body: %s", err)
+			}
+
+			for i, res := range results {
+				want := expects[i].Expect
+				if want == nil {
+					if res.Expected != nil || res.Matched {
+						t.Errorf("%s is checked: %+v", res.URL, res)
+					}
+					continue
+				}
+
+				if res.Expected == nil || *res.Expected != *want || res.Matched != (res.Size == *want) {
+					t.Errorf("%s is checked incorrectly: %+v", res.URL, res)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseSizeCounter_timeout(t *testing.T) {
+	handler := &ResponseSizeCounter{
+		fetchTimeout:    time.Second,
+		maxFetchTimeout: time.Minute,
+	}
+
+	tests := []struct {
+		timeout string
+		want    time.Duration
+	}{
+		{timeout: "", want: time.Second},
+		{timeout: "5s", want: 5 * time.Second},
+		{timeout: "1h", want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := handler.timeout(target{Timeout: tt.timeout}); got != tt.want {
+			t.Errorf("wrong timeout of '%s': want = %s, got = %s", tt.timeout, tt.want, got)
+		}
+	}
+}
+
+func structuredRequest(body string) *http.Request {
+	return &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{"Content-Type": []string{"application/json"}},
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+}
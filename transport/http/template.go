@@ -0,0 +1,66 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// targetTemplate is structured input applying a template of an outbound request to each of given URLs, e.g.
+//
+//	{"method": "POST", "content_type": "application/json", "body_template": "{\"url\": {{json .URL}}}", "urls": ["https://test-1.com/api"]}
+type targetTemplate struct {
+	// Method is a method of outbound requests, POST if empty.
+	Method string `json:"method,omitempty"`
+	// ContentType is a content type of outbound requests bodies, none if empty.
+	ContentType string `json:"content_type,omitempty"`
+	// BodyTemplate is a text/template of outbound requests bodies executed with bodyData of each URL.
+	BodyTemplate string `json:"body_template"`
+
+	URLs []string `json:"urls"`
+}
+
+// bodyData is data a body template is executed with.
+type bodyData struct {
+	// URL is a URL the body is sent to.
+	URL string
+	// Index is a position of the URL within the template URLs, starting from zero.
+	Index int
+}
+
+// bodyTemplateFuncs are functions available to body templates besides the predefined ones.
+var bodyTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{json .URL}} renders a quoted and escaped JSON string.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// targets returns targets of the template URLs having bodies rendered by the template.
+// It fails with errMalformedTargets if the template fails to be parsed or executed.
+func (tt targetTemplate) targets() ([]target, error) {
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Parse(tt.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse body template: %w", errMalformedTargets, err)
+	}
+
+	method := tt.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	targets := make([]target, 0, len(tt.URLs))
+	for i, url := range tt.URLs {
+		var body strings.Builder
+		if err := tmpl.Execute(&body, bodyData{URL: url, Index: i}); err != nil {
+			return nil, fmt.Errorf("%w: '%s' body template: %w", errMalformedTargets, url, err)
+		}
+
+		targets = append(targets, target{URL: url, Method: method, ContentType: tt.ContentType, Body: body.String()})
+	}
+
+	return targets, nil
+}
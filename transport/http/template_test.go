@@ -0,0 +1,113 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_bodyTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	echo := func(want string) func(req *http.Request) (*http.Response, error) {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodPost {
+				t.Errorf("wrong request method: want = %s, got = %s", http.MethodPost, req.Method)
+			}
+			if got := req.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("wrong request content type: want = %s, got = %s", "application/json", got)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Errorf("cannot read request body: %s", err)
+			}
+			if string(body) != want {
+				t.Errorf("wrong request body: want = %s, got = %s", want, string(body))
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+		}
+	}
+
+	client := http_mock.NewMockClient(ctrl)
+	{
+		client.EXPECT().Do(requestTo("https://test-1.com/api")).
+			DoAndReturn(echo(`{"url": "https://test-1.com/api", "n": 0}`))
+		client.EXPECT().Do(requestTo(`https://test-2.com/api?q="quoted"`)).
+			DoAndReturn(echo(`{"url": "https://test-2.com/api?q=\"quoted\"", "n": 1}`))
+	}
+
+	handler := newResponseSizeCounter(t)
+	handler.SetClient(client)
+
+	body := `{
+		"content_type": "application/json",
+		"body_template": "{\"url\": {{json .URL}}, \"n\": {{.Index}}}",
+		"urls": ["https://test-1.com/api", "https://test-2.com/api?q=\"quoted\""]
+	}`
+
+	req := structuredRequest(body)
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, w.Code)
+	}
+
+	var results []Result
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("cannot decode response body: %s", err)
+	}
+
+	want := map[string]int{
+		"https://test-1.com/api":            len(`{"url": "https://test-1.com/api", "n": 0}`),
+		`https://test-2.com/api?q="quoted"`: len(`{"url": "https://test-2.com/api?q=\"quoted\"", "n": 1}`),
+	}
+	if len(results) != len(want) {
+		t.Fatalf("wrong number of results: want = %d, got = %d", len(want), len(results))
+	}
+	for _, res := range results {
+		if res.Size != want[res.URL] {
+			t.Errorf("wrong size of %s: want = %d, got = %d", res.URL, want[res.URL], res.Size)
+		}
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_wrongBodyTemplate(t *testing.T) {
+	for _, body := range []string{
+		`{"body_template": "{{.URL", "urls": ["https://test-1.com"]}`,
+		`{"body_template": "{{end}}", "urls": ["https://test-1.com"]}`,
+		`{"body_template": "{{.Missing}}", "urls": ["https://test-1.com"]}`,
+		`{"body_template": "{{index .URL 100}}", "urls": ["https://test-1.com"]}`,
+		`{"body_template": "{{.URL}}", "urls": ["test-1.xyz"]}`,
+		`{"body_template": "{{.URL}}", "urls": "https://test-1.com"}`,
+	} {
+		ctrl := gomock.NewController(t)
+
+		handler := &ResponseSizeCounter{
+			client: http_mock.NewMockClient(ctrl),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, structuredRequest(body))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong body template '%s' handled incorrectly: status = %d", body, w.Code)
+		}
+
+		ctrl.Finish()
+	}
+}
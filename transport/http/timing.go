@@ -0,0 +1,123 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is a waterfall of phases of fetching a URL, each in nanoseconds when rendered as JSON.
+//
+// Phases of a fetch following redirects are summed up over all of its responses, except of the transfer.
+// Phases of a reused connection are zero but the waiting and the transfer ones.
+type Timings struct {
+	// DNS is a time spent resolving hosts, the same as DNS of a result.
+	DNS time.Duration `json:"dns"`
+	// Connect is a time spent opening TCP connections.
+	Connect time.Duration `json:"connect"`
+	// TLS is a time spent on TLS handshakes.
+	TLS time.Duration `json:"tls"`
+	// TTFB is a time spent waiting for the first response byte once a connection is obtained,
+	// so unlike TTFB of a result it doesn't include the phases above.
+	TTFB time.Duration `json:"ttfb"`
+	// Transfer is a time spent reading the final response since its first byte.
+	Transfer time.Duration `json:"transfer"`
+}
+
+// phaseTimer sums a time of a phase of a fetch reported by httptrace, e.g. of DNS lookups.
+//
+// A dial abandoned by a request, e.g. as an idle connection got free before it, is able to report a phase
+// after the request is done, so the timer is safe for concurrent use.
+type phaseTimer struct {
+	mu      sync.Mutex
+	started time.Time
+	spent   time.Duration
+}
+
+func (t *phaseTimer) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = time.Now()
+}
+
+func (t *phaseTimer) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.started.IsZero() {
+		t.spent += time.Since(t.started)
+		t.started = time.Time{}
+	}
+}
+
+// total returns a time spent by finished phases.
+func (t *phaseTimer) total() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.spent
+}
+
+// waterfall measures phases of a fetch to be reported as Timings.
+type waterfall struct {
+	dns, connect, tls, wait phaseTimer
+
+	mu        sync.Mutex
+	firstByte time.Time
+}
+
+// trace sets hooks of a given trace measuring the phases, along with ones the trace already has,
+// but DNS lookups, which are measured by the dns timer of the waterfall with traceDNS.
+func (w *waterfall) trace(trace *httptrace.ClientTrace) {
+	trace.ConnectStart = func(string, string) { w.connect.start() }
+	trace.ConnectDone = func(string, string, error) { w.connect.done() }
+	trace.TLSHandshakeStart = w.tls.start
+	trace.TLSHandshakeDone = func(tls.ConnectionState, error) { w.tls.done() }
+
+	gotConn := trace.GotConn
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		if gotConn != nil {
+			gotConn(info)
+		}
+		w.wait.start()
+	}
+
+	gotFirstResponseByte := trace.GotFirstResponseByte
+	trace.GotFirstResponseByte = func() {
+		if gotFirstResponseByte != nil {
+			gotFirstResponseByte()
+		}
+		w.wait.done()
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.firstByte = time.Now()
+	}
+}
+
+// timings returns the measured phases, the transfer one lasting till now.
+func (w *waterfall) timings() *Timings {
+	w.mu.Lock()
+	firstByte := w.firstByte
+	w.mu.Unlock()
+
+	t := &Timings{
+		DNS:     w.dns.total(),
+		Connect: w.connect.total(),
+		TLS:     w.tls.total(),
+		TTFB:    w.wait.total(),
+	}
+	if !firstByte.IsZero() {
+		t.Transfer = time.Since(firstByte)
+	}
+
+	return t
+}
+
+// traceDNS sets hooks of a given trace measuring DNS lookups by a given timer.
+func traceDNS(trace *httptrace.ClientTrace, dns *phaseTimer) {
+	trace.DNSStart = func(httptrace.DNSStartInfo) { dns.start() }
+	trace.DNSDone = func(httptrace.DNSDoneInfo) { dns.done() }
+}
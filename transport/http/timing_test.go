@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTimings(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer srv.Close()
+
+	handler := newResponseSizeCounter(t, WithCABundle(certPEM(srv)), WithTimings())
+
+	for i, wantConnect := range []bool{true, false} {
+		result, err := handler.do(context.Background(), target{URL: srv.URL})
+		if err != nil {
+			t.Fatalf("fetch #%d: unexpected error: %v", i, err)
+		}
+
+		timings := result.Timings
+		if timings == nil {
+			t.Fatalf("fetch #%d: timings are not reported", i)
+		}
+
+		if connected := timings.Connect > 0 && timings.TLS > 0; connected != wantConnect {
+			t.Errorf("fetch #%d: wrong connect and TLS timings: %s and %s", i, timings.Connect, timings.TLS)
+		}
+		if timings.TTFB < delay || timings.Transfer < delay {
+			t.Errorf("fetch #%d: waiting or transfer time is shorter than the delay: %s and %s", i, timings.TTFB, timings.Transfer)
+		}
+
+		sum := timings.DNS + timings.Connect + timings.TLS + timings.TTFB + timings.Transfer
+		if sum > result.Latency || result.Latency-sum > result.Latency/5 {
+			t.Errorf("fetch #%d: phases don't sum up to the latency: %+v of %s", i, *timings, result.Latency)
+		}
+	}
+}
+
+func TestResponseSizeCounter_do_noTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	result, err := newResponseSizeCounter(t).do(context.Background(), target{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Timings != nil {
+		t.Errorf("timings are reported: %+v", *result.Timings)
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// unixScheme is a scheme of URLs fetched over Unix domain sockets.
+//
+// A path of such URL holds a socket path and a request path separated by a colon,
+// e.g. http+unix://localhost/var/run/app.sock:/status requests /status of a service
+// listening on /var/run/app.sock with 'localhost' Host header.
+const unixScheme = "http+unix"
+
+// errSocketNotAllowed fails fetches of URLs of a socket out of the allowlist.
+var errSocketNotAllowed = errors.New("socket is not allowed")
+
+// unixTransport is an implementation of http.RoundTripper performing requests over Unix domain sockets.
+type unixTransport struct {
+	transport *http.Transport
+	// sockets holds paths of sockets requests are allowed to be performed over.
+	sockets map[string]bool
+}
+
+// newUnixTransport returns a transport performing requests over given sockets, configured the same
+// as a given transport except it dials sockets with a given dialer's timeout and bypasses proxies.
+func newUnixTransport(base *http.Transport, dialer *net.Dialer, sockets []string) *unixTransport {
+	transport := base.Clone()
+	transport.Proxy = nil
+	transport.DialContext = unixDialer{dialer: &net.Dialer{Timeout: dialer.Timeout}}.DialContext
+
+	allowed := make(map[string]bool, len(sockets))
+	for _, socket := range sockets {
+		allowed[socket] = true
+	}
+
+	return &unixTransport{transport: transport, sockets: allowed}
+}
+
+// RoundTrip performs a request to a service listening on a socket given within a request URL.
+func (t *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	socket, path, ok := strings.Cut(req.URL.Path, ":")
+	if !ok || socket == "" {
+		return nil, fmt.Errorf("'%s' holds no socket path", req.URL)
+	}
+
+	if !t.sockets[filepath.Clean(socket)] {
+		return nil, fmt.Errorf("'%s': %w", socket, errSocketNotAllowed)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	req = req.Clone(req.Context())
+	req.Host = host
+	req.URL.Scheme = "http"
+	// the socket path is encoded to be a valid host, so connections to different sockets are pooled separately
+	req.URL.Host = hex.EncodeToString([]byte(socket))
+	req.URL.Path = path
+	req.URL.RawPath = ""
+
+	return t.transport.RoundTrip(req)
+}
+
+// unixDialer dials sockets of addresses of requests made by unixTransport.
+type unixDialer struct {
+	dialer *net.Dialer
+}
+
+// DialContext connects to a socket which path is hex-encoded in a host of a given address.
+func (d unixDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	socket, err := hex.DecodeString(host)
+	if err != nil {
+		return nil, fmt.Errorf("decode socket path: %s", err)
+	}
+
+	return d.dialer.DialContext(ctx, "unix", string(socket))
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithUnixSockets(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("cannot listen on unix socket: %s", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/status" || req.Host != "localhost" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	url := "http+unix://localhost" + socket + ":/status"
+
+	t.Run("enabled", func(t *testing.T) {
+		// the headers limit of the configured transport applies to sockets as well
+		handler := newResponseSizeCounter(t, WithUnixSockets([]string{socket}), WithMaxHeaderBytes(1))
+
+		if _, err := handler.do(context.Background(), target{URL: url}); err == nil {
+			t.Error("unix socket transport is not derived from the configured one")
+		}
+
+		handler = newResponseSizeCounter(t, WithUnixSockets([]string{socket}))
+
+		result, err := handler.do(context.Background(), target{URL: url})
+		if err != nil {
+			t.Fatalf("cannot get response over unix socket: %s", err)
+		}
+
+		if result.Size != 2 {
+			t.Errorf("wrong response size: want = %d, got = %d", 2, result.Size)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler := newResponseSizeCounter(t)
+
+		if _, err := handler.do(context.Background(), target{URL: url}); err == nil {
+			t.Error("unix socket url is fetched while not enabled")
+		}
+	})
+
+	t.Run("dial timeout", func(t *testing.T) {
+		handler := newResponseSizeCounter(t, WithUnixSockets([]string{socket}), WithDialTimeout(time.Nanosecond))
+
+		var netErr net.Error
+		if _, err := handler.do(context.Background(), target{URL: url}); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("dial timeout is not applied to unix sockets: %v", err)
+		}
+	})
+
+	t.Run("socket not allowed", func(t *testing.T) {
+		handler := newResponseSizeCounter(t, WithUnixSockets([]string{filepath.Join(t.TempDir(), "other.sock")}))
+
+		if _, err := handler.do(context.Background(), target{URL: url}); !errors.Is(err, errSocketNotAllowed) {
+			t.Errorf("wrong error: want = %v, got = %v", errSocketNotAllowed, err)
+		}
+	})
+
+	t.Run("no socket path", func(t *testing.T) {
+		handler := newResponseSizeCounter(t, WithUnixSockets([]string{socket}))
+
+		if _, err := handler.do(context.Background(), target{URL: "http+unix://localhost/status"}); err == nil {
+			t.Error("url without socket path handled incorrectly")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// lineError describes an invalid line of a request body.
+type lineError struct {
+	// Line is a 1-based number of the line within the request body.
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// invalidLines is an error listing every invalid line of a request body.
+type invalidLines []lineError
+
+func (e invalidLines) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, le := range e {
+		msgs = append(msgs, fmt.Sprintf("line %d: '%s' %s", le.Line, le.Text, le.Error))
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// writeInvalidLines responds with a 400 status listing invalid lines,
+// as a JSON object if a JSON response is requested and as plain text otherwise.
+func writeInvalidLines(w http.ResponseWriter, lines invalidLines, p params) {
+	if p.format.contentType != jsonFormat.contentType {
+		http.Error(w, fmt.Sprintf("get urls:\n%s", lines), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonFormat.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Errors invalidLines `json:"errors"`
+	}{lines})
+}
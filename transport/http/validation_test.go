@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_invalidLines(t *testing.T) {
+	body := `https://test-1.com
+test-2.xyz
+
+# comment
+https://test-3.com
+test 4
+ftp:/test-5`
+
+	want := invalidLines{
+		{Line: 2, Text: "test-2.xyz", Error: "is not a URL"},
+		{Line: 6, Text: "test 4", Error: "is not a URL"},
+		{Line: 7, Text: "ftp:/test-5", Error: "is not a URL"},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := &ResponseSizeCounter{
+			client:        http_mock.NewMockClient(ctrl),
+			commentPrefix: "#",
+		}
+
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &net_url.URL{RawQuery: "format=json"},
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("wrong response status: want = %d, got = %d", http.StatusBadRequest, w.Code)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != jsonFormat.contentType {
+			t.Errorf("wrong content type: want = %s, got = %s", jsonFormat.contentType, ct)
+		}
+
+		var res struct {
+			Errors invalidLines `json:"errors"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("cannot decode response body: %s", err)
+		}
+
+		if len(res.Errors) != len(want) {
+			t.Fatalf("wrong number of invalid lines: want = %v, got = %v", want, res.Errors)
+		}
+
+		for i := range want {
+			if res.Errors[i] != want[i] {
+				t.Errorf("wrong invalid line: want = %+v, got = %+v", want[i], res.Errors[i])
+			}
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := &ResponseSizeCounter{
+			client:        http_mock.NewMockClient(ctrl),
+			commentPrefix: "#",
+		}
+
+		req := &http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("wrong response status: want = %d, got = %d", http.StatusBadRequest, w.Code)
+		}
+
+		for _, le := range want {
+			if line := (invalidLines{le}).Error(); !strings.Contains(w.Body.String(), line) {
+				t.Errorf("invalid line is not reported: want %q within %q", line, w.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Build metadata reported by VersionHandler, injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/laonix/sample-handler/transport/http.Version=v1.2.0 \
+//		-X github.com/laonix/sample-handler/transport/http.Commit=$(git rev-parse HEAD) \
+//		-X github.com/laonix/sample-handler/transport/http.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// versionPath is a path MakeResponseSizeCounter serves VersionHandler at.
+const versionPath = "/version"
+
+// VersionHandler returns a handler responding to GET requests with build metadata as a JSON object,
+// e.g. {"version": "v1.2.0", "commit": "c2fc538", "build_time": "2024-05-01T10:00:00Z"}.
+func VersionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Only GET method supported.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonFormat.contentType)
+
+		_ = json.NewEncoder(w).Encode(struct {
+			Version   string `json:"version"`
+			Commit    string `json:"commit"`
+			BuildTime string `json:"build_time"`
+		}{Version, Commit, BuildTime})
+	})
+}
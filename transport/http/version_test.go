@@ -0,0 +1,50 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	version, commit, buildTime := Version, Commit, BuildTime
+	defer func() {
+		Version, Commit, BuildTime = version, commit, buildTime
+	}()
+
+	Version, Commit, BuildTime = "v1.2.0", "c2fc538", "2024-05-01T10:00:00Z"
+
+	// the version is served by MakeResponseSizeCounter at /version as well
+	for _, handler := range []http.Handler{VersionHandler(), MakeResponseSizeCounter()} {
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong response status: want = %d, got = %d", http.StatusOK, w.Code)
+		}
+
+		var got map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("cannot decode response body: %s", err)
+		}
+
+		want := map[string]string{"version": "v1.2.0", "commit": "c2fc538", "build_time": "2024-05-01T10:00:00Z"}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("wrong %s: want = %s, got = %s", key, value, got[key])
+			}
+		}
+	}
+}
+
+func TestVersionHandler_wrongMethod(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	VersionHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/version", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong response status: want = %d, got = %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,368 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID is a GUID the WebSocket protocol concatenates with a client key to accept a handshake, see RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage limits a size of a message a WebSocket client is able to send.
+const wsMaxMessage = 1 << 20
+
+// wsMaxCloseReason limits a size of a reason of a close frame, as control frames carry 125 bytes at most.
+const wsMaxCloseReason = 123
+
+// WebSocket frame opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// WebSocket close status codes.
+const (
+	wsNormalClosure   = 1000
+	wsProtocolError   = 1002
+	wsUnsupported     = 1003
+	wsInvalidData     = 1007
+	wsPolicyViolation = 1008
+	wsTooBig          = 1009
+)
+
+var (
+	errWSUnsupported = errors.New("only text messages are supported")
+	errWSTooBig      = errors.New("message is too big")
+	errWSClosed      = errors.New("connection is closed by the client")
+	errWSUnmasked    = errors.New("client frames must be masked")
+)
+
+// I'd rather use github.com/gorilla/websocket,
+// but here we go
+
+// isWebSocket reports whether a request asks to upgrade a connection to WebSocket.
+func isWebSocket(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket") && headerHasToken(req.Header, "Connection", "upgrade")
+}
+
+// headerHasToken reports whether a comma-separated header holds a given token, case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// serveWebSocket upgrades a connection to WebSocket, reads URLs from the first message of a client
+// and writes each result as a JSON message as soon as its URL is fetched.
+//
+// Fetching is cancelled if the client closes the connection.
+func (h *ResponseSizeCounter) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Only GET method supported for WebSocket.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" || req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket handshake.", http.StatusBadRequest)
+		return
+	}
+
+	p, err := parseParams(req)
+	if err != nil {
+		http.Error(w, fmt.Errorf("parse query: %s", err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	named, ok := h.namedLists[p.list]
+	if p.list != "" && !ok {
+		http.Error(w, fmt.Sprintf("parse query: '%s' is not a known list", p.list), http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, fmt.Errorf("hijack connection: %s", err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ws := &wsConn{conn: conn, rw: rw}
+	defer closeWSConn(ws)
+
+	if err := ws.accept(key); err != nil {
+		log.Printf("accept websocket: %s", err)
+		return
+	}
+
+	message, err := ws.readMessage()
+	if err != nil {
+		ws.closeWithError(err)
+		return
+	}
+
+	targets, err := h.parseTargets(string(message))
+	if err != nil {
+		_ = ws.writeClose(wsInvalidData, fmt.Sprintf("get urls: %s", err))
+		return
+	}
+
+	if len(named) > 0 {
+		targets = append(urlTargets(named), targets...)
+	}
+
+	if err := h.allowedHosts.disallowed(targets); err != nil {
+		_ = ws.writeClose(wsPolicyViolation, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	// the client is not expected to send anything else, reading detects it going away
+	go func() {
+		defer cancel()
+		for {
+			if _, err := ws.readMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	results := make(chan Result, h.streamWorkers())
+	go func() {
+		defer close(results)
+		h.fetchTo(ctx, targets, results, p)
+	}()
+
+	pace := pacer{interval: p.streamRate}
+
+	for res := range results {
+		if ctx.Err() != nil || !pace.wait(ctx) {
+			continue
+		}
+
+		if h.streamIdleTimeout > 0 {
+			_ = ws.conn.SetWriteDeadline(time.Now().Add(h.streamIdleTimeout))
+		}
+
+		message, err := json.Marshal(res)
+		if err == nil {
+			err = ws.writeFrame(wsText, message)
+		}
+		if err != nil {
+			log.Printf("stream result to websocket: %s", err)
+			cancel()
+		}
+	}
+
+	if ctx.Err() == nil {
+		_ = ws.writeClose(wsNormalClosure, "")
+	}
+}
+
+// wsConn is a server side of a WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// mu serializes writes of frames.
+	mu sync.Mutex
+}
+
+// accept completes a WebSocket handshake of a client having a given key.
+func (ws *wsConn) accept(key string) error {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+
+	_, err := fmt.Fprintf(ws.rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+
+	return ws.rw.Flush()
+}
+
+// readMessage reads a text message of a client answering its pings meanwhile.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return nil, errWSClosed
+		case wsText, wsContinuation:
+		default:
+			return nil, errWSUnsupported
+		}
+
+		if len(message)+len(payload) > wsMaxMessage {
+			return nil, errWSTooBig
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame of a client unmasking its payload, an unmasked frame fails with errWSUnmasked.
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errWSUnmasked
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > wsMaxMessage {
+		return false, 0, nil, errWSTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unmasked frame of a given opcode.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+
+	return ws.rw.Flush()
+}
+
+// writeClose writes a close frame with a given status code and reason.
+// A reason longer than wsMaxCloseReason bytes is truncated, keeping it valid UTF-8.
+func (ws *wsConn) writeClose(code int, reason string) error {
+	if len(reason) > wsMaxCloseReason {
+		cut := wsMaxCloseReason
+		for cut > 0 && !utf8.RuneStart(reason[cut]) {
+			cut--
+		}
+		reason = reason[:cut]
+	}
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+
+	return ws.writeFrame(wsClose, append(payload, reason...))
+}
+
+// closeWithError writes a close frame describing a given error of reading a message of a client.
+func (ws *wsConn) closeWithError(err error) {
+	switch {
+	case errors.Is(err, errWSClosed):
+		_ = ws.writeClose(wsNormalClosure, "")
+	case errors.Is(err, errWSUnmasked):
+		_ = ws.writeClose(wsProtocolError, err.Error())
+	case errors.Is(err, errWSUnsupported):
+		_ = ws.writeClose(wsUnsupported, err.Error())
+	case errors.Is(err, errWSTooBig):
+		_ = ws.writeClose(wsTooBig, err.Error())
+	default:
+		log.Printf("read websocket message: %s", err)
+	}
+}
+
+func closeWSConn(ws *wsConn) {
+	if err := ws.conn.Close(); err != nil {
+		log.Printf("close websocket connection: %s", err)
+	}
+}
@@ -0,0 +1,224 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/mock/gomock"
+
+	http_mock "github.com/laonix/sample-handler/transport/http/mock"
+)
+
+func TestResponseSizeCounter_ServeHTTP_websocket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := http_mock.NewMockClient(ctrl)
+	client.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		return response(http.StatusOK), nil
+	}).Times(3)
+
+	handler := &ResponseSizeCounter{
+		client:       client,
+		streamBuffer: defaultStreamBuffer,
+	}
+
+	srv := httptest.NewServer(Gzip(gzip.DefaultCompression)(handler))
+	defer srv.Close()
+
+	ws := dialWebSocket(t, srv.Listener.Addr().String())
+	defer func() { _ = ws.conn.Close() }()
+
+	ws.writeText(t, "https://test-1.com\nhttp://test-2.com\nhttps://test-3.com")
+
+	urls := make(map[string]bool)
+	for {
+		opcode, payload := ws.readFrame(t)
+		if opcode == wsClose {
+			if code := binary.BigEndian.Uint16(payload); code != wsNormalClosure {
+				t.Errorf("wrong close code: want = %d, got = %d", wsNormalClosure, code)
+			}
+			break
+		}
+
+		if opcode != wsText {
+			t.Fatalf("wrong opcode: want = %d, got = %d", wsText, opcode)
+		}
+
+		var res Result
+		if err := json.Unmarshal(payload, &res); err != nil {
+			t.Fatalf("cannot decode result message: %s", err)
+		}
+
+		if res.Size != 25000 {
+			t.Errorf("wrong size of %s: want = %d, got = %d", res.URL, 25000, res.Size)
+		}
+		urls[res.URL] = true
+	}
+
+	if len(urls) != 3 {
+		t.Errorf("wrong number of result messages: want = %d, got = %d", 3, len(urls))
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_websocketWrongInput(t *testing.T) {
+	handler := &ResponseSizeCounter{}
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	ws := dialWebSocket(t, srv.Listener.Addr().String())
+	defer func() { _ = ws.conn.Close() }()
+
+	ws.writeText(t, "test-1.xyz")
+
+	opcode, payload := ws.readFrame(t)
+	if opcode != wsClose {
+		t.Fatalf("wrong opcode: want = %d, got = %d", wsClose, opcode)
+	}
+
+	if code := binary.BigEndian.Uint16(payload); code != wsInvalidData {
+		t.Errorf("wrong close code: want = %d, got = %d", wsInvalidData, code)
+	}
+}
+
+func TestResponseSizeCounter_ServeHTTP_websocketUnmasked(t *testing.T) {
+	handler := &ResponseSizeCounter{}
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	ws := dialWebSocket(t, srv.Listener.Addr().String())
+	defer func() { _ = ws.conn.Close() }()
+
+	text := "https://test-1.com"
+	if _, err := ws.conn.Write(append([]byte{0x80 | wsText, byte(len(text))}, text...)); err != nil {
+		t.Fatalf("cannot write message: %s", err)
+	}
+
+	opcode, payload := ws.readFrame(t)
+	if opcode != wsClose {
+		t.Fatalf("wrong opcode: want = %d, got = %d", wsClose, opcode)
+	}
+
+	if code := binary.BigEndian.Uint16(payload); code != wsProtocolError {
+		t.Errorf("wrong close code: want = %d, got = %d", wsProtocolError, code)
+	}
+}
+
+func TestWSConn_writeClose_longReason(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+
+	ws := &wsConn{conn: server, rw: bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))}
+	go func() {
+		defer closeWSConn(ws)
+		_ = ws.writeClose(wsInvalidData, strings.Repeat("é", 100))
+	}()
+
+	opcode, payload := (&wsClient{conn: client, r: bufio.NewReader(client)}).readFrame(t)
+	if opcode != wsClose {
+		t.Fatalf("wrong opcode: want = %d, got = %d", wsClose, opcode)
+	}
+
+	// 61 two-byte runes fit into 123 bytes, a half of the 62nd one is cut off
+	reason := payload[2:]
+	if len(reason) != 122 || !utf8.Valid(reason) {
+		t.Errorf("wrong close reason: %d bytes, valid UTF-8 = %t", len(reason), utf8.Valid(reason))
+	}
+}
+
+// wsClient is a client side of a WebSocket connection.
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, addr string) *wsClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("cannot dial server: %s", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n"+
+		"Host: "+addr+"\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Accept-Encoding: gzip\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatalf("cannot write handshake: %s", err)
+	}
+
+	r := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("cannot read handshake response: %s", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("wrong handshake status: want = %d, got = %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	// the accept value of the sample key from RFC 6455
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("wrong handshake accept: %s", accept)
+	}
+
+	return &wsClient{conn: conn, r: r}
+}
+
+// writeText writes a masked text frame.
+func (c *wsClient) writeText(t *testing.T, text string) {
+	mask := [4]byte{1, 2, 3, 4}
+
+	frame := []byte{0x80 | wsText, 0x80 | 126, 0, 0}
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(text)))
+	frame = append(frame, mask[:]...)
+	for i := 0; i < len(text); i++ {
+		frame = append(frame, text[i]^mask[i%4])
+	}
+
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatalf("cannot write message: %s", err)
+	}
+}
+
+// readFrame reads an unmasked frame.
+func (c *wsClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		t.Fatalf("cannot read frame: %s", err)
+	}
+
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			t.Fatalf("cannot read frame: %s", err)
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("cannot read frame: %s", err)
+	}
+
+	return header[0] & 0x0f, payload
+}